@@ -79,7 +79,7 @@ func (s *SmartViewSession) aesDecrypt(cipherdata []byte) ([]byte, error) {
 	// Decrypt
 	plaintext := make([]byte, len(cipherdata))
 	for plainrange := plaintext; len(cipherdata) > 0; {
-		block.Decrypt(plaintext, cipherdata[:bs])
+		block.Decrypt(plainrange, cipherdata[:bs])
 		cipherdata = cipherdata[bs:]
 		plainrange = plainrange[bs:]
 	}
@@ -110,7 +110,7 @@ func pkcs7Unpad(data []byte, bs int) ([]byte, error) {
 	}
 	padstart := len(data) - padlen
 	for i := 0; i < padlen; i++ {
-		if data[padstart+1] != padchar {
+		if data[padstart+i] != padchar {
 			return nil, errors.New("invalid padding char")
 		}
 	}
@@ -0,0 +1,84 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAESRoundTrip(t *testing.T) {
+	s := &SmartViewSession{sessionKey: []byte("0123456789abcdef")}
+
+	// Messages longer than a block check every block is decrypted in place
+	for _, size := range []int{0, 1, 15, 16, 17, 40, 100} {
+		plain := bytes.Repeat([]byte("x"), size)
+		for i := range plain {
+			plain[i] = byte('a' + i%26)
+		}
+		enc, err := s.aesEncrypt(append([]byte{}, plain...))
+		if err != nil {
+			t.Fatalf("size %d: encryption failed: %v", size, err)
+		}
+		dec, err := s.aesDecrypt(enc)
+		if err != nil {
+			t.Fatalf("size %d: decryption failed: %v", size, err)
+		}
+		if !bytes.Equal(dec, plain) {
+			t.Errorf("size %d: got %q, want %q", size, dec, plain)
+		}
+	}
+}
+
+func TestPKCS7Unpad(t *testing.T) {
+	block := func(tail ...byte) []byte {
+		b := bytes.Repeat([]byte{'a'}, 16-len(tail))
+		return append(b, tail...)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []byte
+		wantErr bool
+	}{
+		{"one byte", block(1), bytes.Repeat([]byte{'a'}, 15), false},
+		{"four bytes", block(4, 4, 4, 4), bytes.Repeat([]byte{'a'}, 12), false},
+		{"full block", bytes.Repeat([]byte{16}, 16), []byte{}, false},
+		// Only the second padding byte is correct
+		{"bad first byte", block(9, 4, 4, 4), nil, true},
+		{"bad third byte", block(4, 4, 9, 4), nil, true},
+		{"zero padding", block(0), nil, true},
+		{"padding too long", block(17), nil, true},
+		{"partial block", []byte{1, 1, 1}, nil, true},
+		{"empty", nil, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := pkcs7Unpad(tt.data, 16)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
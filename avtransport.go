@@ -0,0 +1,181 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AVTransportService is the UPnP AVTransport service type
+const AVTransportService = "urn:schemas-upnp-org:service:AVTransport:1"
+
+// Transport states
+const (
+	TransportStopped       = "STOPPED"
+	TransportPlaying       = "PLAYING"
+	TransportPaused        = "PAUSED_PLAYBACK"
+	TransportTransitioning = "TRANSITIONING"
+	TransportNoMedia       = "NO_MEDIA_PRESENT"
+)
+
+// AVTransport is a client of the TV UPnP AVTransport service, used to play
+// media on the TV
+type AVTransport struct {
+	svc *upnpService
+}
+
+// TransportPosition contains the playback position
+type TransportPosition struct {
+	Track    int
+	URI      string
+	Duration time.Duration
+	Position time.Duration
+}
+
+// NewAVTransport finds the AVTransport service of the TV
+// The service is discovered like the RenderingControl service.
+func NewAVTransport(tvAddress string, ports Ports) (*AVTransport, error) {
+	svc, err := findMediaRendererService(tvAddress, ports, AVTransportService)
+	if err != nil {
+		return nil, err
+	}
+	return &AVTransport{svc: svc}, nil
+}
+
+var instanceZero = soapArg{"InstanceID", "0"}
+
+// SetURI sets the media to be played, with its DIDL-Lite metadata
+func (t *AVTransport) SetURI(uri, metadata string) error {
+	_, err := t.svc.call("SetAVTransportURI", instanceZero,
+		soapArg{"CurrentURI", uri}, soapArg{"CurrentURIMetaData", metadata})
+	return err
+}
+
+// Play starts or resumes the playback
+func (t *AVTransport) Play() error {
+	_, err := t.svc.call("Play", instanceZero, soapArg{"Speed", "1"})
+	return err
+}
+
+// Pause pauses the playback
+func (t *AVTransport) Pause() error {
+	_, err := t.svc.call("Pause", instanceZero)
+	return err
+}
+
+// Stop stops the playback
+func (t *AVTransport) Stop() error {
+	_, err := t.svc.call("Stop", instanceZero)
+	return err
+}
+
+// Seek moves to the given position in the current media
+func (t *AVTransport) Seek(pos time.Duration) error {
+	if pos < 0 {
+		pos = 0
+	}
+	_, err := t.svc.call("Seek", instanceZero,
+		soapArg{"Unit", "REL_TIME"}, soapArg{"Target", FormatUPnPDuration(pos)})
+	return err
+}
+
+// State returns the transport state (TransportPlaying, etc.)
+func (t *AVTransport) State() (string, error) {
+	out, err := t.svc.call("GetTransportInfo", instanceZero)
+	if err != nil {
+		return "", err
+	}
+	return out["CurrentTransportState"], nil
+}
+
+// Position returns the playback position
+func (t *AVTransport) Position() (TransportPosition, error) {
+	var p TransportPosition
+	out, err := t.svc.call("GetPositionInfo", instanceZero)
+	if err != nil {
+		return p, err
+	}
+	p.Track, _ = strconv.Atoi(out["Track"])
+	p.URI = out["TrackURI"]
+	p.Duration, _ = ParseUPnPDuration(out["TrackDuration"])
+	p.Position, _ = ParseUPnPDuration(out["RelTime"])
+	return p, nil
+}
+
+// ParseUPnPDuration parses a UPnP duration (H+:MM:SS[.F+])
+func ParseUPnPDuration(s string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return 0, errors.Errorf("invalid duration '%s'", s)
+	}
+	h, err1 := strconv.Atoi(parts[0])
+	m, err2 := strconv.Atoi(parts[1])
+	sec, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, errors.Errorf("invalid duration '%s'", s)
+	}
+	d := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute
+	return d + time.Duration(sec*float64(time.Second)), nil
+}
+
+// FormatUPnPDuration formats a duration as H:MM:SS
+func FormatUPnPDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := d / time.Hour
+	m := (d % time.Hour) / time.Minute
+	s := (d % time.Minute) / time.Second
+	return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+}
+
+// DIDLLite returns the DIDL-Lite metadata of a media item
+// The UPnP class is deduced from the MIME type.
+func DIDLLite(title, uri, mimeType string) string {
+	class := "object.item"
+	switch {
+	case strings.HasPrefix(mimeType, "video/"):
+		class = "object.item.videoItem"
+	case strings.HasPrefix(mimeType, "audio/"):
+		class = "object.item.audioItem.musicTrack"
+	case strings.HasPrefix(mimeType, "image/"):
+		class = "object.item.imageItem.photo"
+	}
+
+	esc := func(s string) string {
+		var b bytes.Buffer
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	return `<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" ` +
+		`xmlns:dc="http://purl.org/dc/elements/1.1/" ` +
+		`xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/">` +
+		`<item id="0" parentID="-1" restricted="1">` +
+		`<dc:title>` + esc(title) + `</dc:title>` +
+		`<upnp:class>` + class + `</upnp:class>` +
+		`<res protocolInfo="http-get:*:` + esc(mimeType) + `:*">` + esc(uri) + `</res>` +
+		`</item></DIDL-Lite>`
+}
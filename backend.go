@@ -0,0 +1,175 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv
+
+import (
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// SmartViewBackend is the name of the SmartView backend (2014/2015 models)
+const SmartViewBackend = "smartview"
+
+// ErrNotSupported is returned when an operation is not supported by the
+// backend
+var ErrNotSupported = errors.New("operation not supported by the backend")
+
+// ErrAccessDenied is returned when the connection has been denied on the TV
+var ErrAccessDenied = errors.New("access denied by the TV")
+
+// ErrAccessTimeout is returned when the connection has not been allowed on
+// the TV in time
+var ErrAccessTimeout = errors.New("timeout waiting for the TV authorization")
+
+// Backend is the interface of a TV remote control protocol implementation
+type Backend interface {
+	// Name returns the backend name
+	Name() string
+	// Connect opens the connection to the TV
+	Connect() error
+	// Close terminates the connection
+	Close()
+	// Key sends a key to the TV
+	Key(key string) error
+	// DeviceDescription fetches the description from the TV
+	DeviceDescription() (SmartDeviceDescription, error)
+	// PairWith handles the pairing process; the PIN provider is used
+	// if the TV displays a PIN code.
+	PairWith(p PINProvider) (Credentials, error)
+	// Credentials returns the current credentials
+	Credentials() Credentials
+	// SetCredentials sets the credentials used to connect to the TV
+	SetCredentials(c Credentials) error
+}
+
+// KeyPresser is implemented by the backends that can send separate key
+// press and release events, e.g. for long key presses
+type KeyPresser interface {
+	// Press sends a key press event
+	Press(key string) error
+	// Release sends a key release event
+	Release(key string) error
+}
+
+// BackendOptions contains the settings used to create a backend
+type BackendOptions struct {
+	Address     string      // TV IP address
+	Ports       Ports       // Service ports (zero values for the defaults)
+	Credentials Credentials // Stored credentials or pairing identity
+}
+
+// BackendFactory is a function creating a backend
+type BackendFactory func(opts BackendOptions) (Backend, error)
+
+var backends = struct {
+	sync.Mutex
+	factories map[string]BackendFactory
+}{
+	factories: map[string]BackendFactory{
+		SmartViewBackend: newSmartViewBackend,
+		TizenBackend:     newTizenBackend,
+		LegacyBackend:    newLegacyBackend,
+	},
+}
+
+// RegisterBackend registers a backend factory with the given name
+func RegisterBackend(name string, f BackendFactory) {
+	backends.Lock()
+	backends.factories[strings.ToLower(name)] = f
+	backends.Unlock()
+}
+
+// Backends returns the sorted list of the registered backend names
+func Backends() []string {
+	backends.Lock()
+	defer backends.Unlock()
+	var names []string
+	for name := range backends.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewBackend creates a backend with the given name
+// The SmartView backend is used if the name is empty.
+func NewBackend(name string, opts BackendOptions) (Backend, error) {
+	if name == "" {
+		name = SmartViewBackend
+	}
+	backends.Lock()
+	f := backends.factories[strings.ToLower(name)]
+	backends.Unlock()
+	if f == nil {
+		return nil, errors.Errorf("unknown backend '%s' (available: %s)",
+			name, strings.Join(Backends(), ", "))
+	}
+	return f(opts)
+}
+
+func newSmartViewBackend(opts BackendOptions) (Backend, error) {
+	s, err := NewSmartViewSession(opts.Address)
+	if err != nil {
+		return nil, err
+	}
+	s.SetPorts(opts.Ports)
+	if err := s.SetCredentials(opts.Credentials); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SmartViewSession implements the Backend interface
+var _ Backend = (*SmartViewSession)(nil)
+
+// Name returns the backend name
+func (s *SmartViewSession) Name() string {
+	return SmartViewBackend
+}
+
+// Connect opens the connection to the TV (see InitSession)
+func (s *SmartViewSession) Connect() error {
+	return s.InitSession()
+}
+
+// SetCredentials sets the session credentials and the pairing identity
+// Empty values are ignored.
+func (s *SmartViewSession) SetCredentials(c Credentials) error {
+	// Check the session key (16 bytes, hex-encoded)
+	if l := len(c.SessionKey); l != 0 && l != 32 {
+		return errors.New("invalid session key, should be a 32-byte hex string")
+	}
+	sessionKey, err := hex.DecodeString(c.SessionKey)
+	if err != nil {
+		return errors.Wrap(err, "cannot convert hex key string")
+	}
+	if len(sessionKey) == 0 {
+		sessionKey = nil
+	}
+
+	s.RestoreSessionData(sessionKey, c.SessionID, c.DeviceUUID)
+	s.SetPairingIdentity(c.AppID, c.UserID)
+	return nil
+}
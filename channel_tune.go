@@ -0,0 +1,171 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ChannelDashKey is the key used to type the dash of a sub-channel number
+const ChannelDashKey = "KEY_PLUS100"
+
+var channelNumberRe = regexp.MustCompile(`^(\d+)(?:[-.](\d+))?$`)
+
+// ParseChannelNumber parses a channel number ("5" or "5-1")
+// The minor number is 0 if there is no sub-channel.
+func ParseChannelNumber(s string) (major, minor int, err error) {
+	m := channelNumberRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, 0, errors.Errorf("invalid channel number '%s'", s)
+	}
+	major, _ = strconv.Atoi(m[1])
+	if m[2] != "" {
+		minor, _ = strconv.Atoi(m[2])
+	}
+	return major, minor, nil
+}
+
+// ChannelKeys returns the key sequence used to tune a channel number
+// ("5-1" is typed as KEY_5 KEY_PLUS100 KEY_1 KEY_ENTER).
+func ChannelKeys(number string) ([]string, error) {
+	major, minor, err := ParseChannelNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, d := range strconv.Itoa(major) {
+		keys = append(keys, "KEY_"+string(d))
+	}
+	if minor > 0 && minor != noMinorChannel {
+		keys = append(keys, ChannelDashKey)
+		for _, d := range strconv.Itoa(minor) {
+			keys = append(keys, "KEY_"+string(d))
+		}
+	}
+	return append(keys, "KEY_ENTER"), nil
+}
+
+// FindChannelNumber returns the channel with the given number, if any
+func FindChannelNumber(channels []TVChannel, number string) (TVChannel, bool) {
+	major, minor, err := ParseChannelNumber(number)
+	if err != nil {
+		return TVChannel{}, false
+	}
+	for _, ch := range channels {
+		chMinor := ch.Minor
+		if chMinor == noMinorChannel {
+			chMinor = 0
+		}
+		if ch.Major == major && chMinor == minor {
+			return ch, true
+		}
+	}
+	return TVChannel{}, false
+}
+
+// FindChannelName returns the channels matching a name, best matches first
+// The names are compared ignoring the case and the punctuation.  Exact
+// matches are preferred, then prefixes and substrings, then names with
+// a small edit distance.
+func FindChannelName(channels []TVChannel, name string) []TVChannel {
+	q := normalizeName(name)
+	if q == "" {
+		return nil
+	}
+
+	type match struct {
+		ch    TVChannel
+		score int
+	}
+	var matches []match
+	for _, ch := range channels {
+		n := normalizeName(ch.Name)
+		if n == "" {
+			continue
+		}
+		score := -1
+		switch {
+		case n == q:
+			score = 0
+		case strings.HasPrefix(n, q):
+			score = 1
+		case strings.Contains(n, q):
+			score = 2
+		default:
+			if d := editDistance(n, q); d <= len(q)/4+1 {
+				score = 2 + d
+			}
+		}
+		if score >= 0 {
+			matches = append(matches, match{ch, score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score < matches[j].score
+	})
+	// Only keep the best matches
+	var result []TVChannel
+	for _, m := range matches {
+		if m.score != matches[0].score {
+			break
+		}
+		result = append(result, m.ch)
+	}
+	return result
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
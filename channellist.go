@@ -0,0 +1,193 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+// Channel list record layout (H/J models)
+// Samsung does not document this format; the layout is the one of the
+// binary lists served at the MainTVAgent2 GetChannelListURL location, as
+// reverse-engineered for these models.  testdata/channellist.bin is a
+// sample list following it.
+// The list starts with a 4-byte header, followed by fixed-size records:
+//
+//	0x00 uint16  channel type code
+//	0x02 uint16  major number
+//	0x04 uint16  minor number
+//	0x06 uint16  physical channel (PTC)
+//	0x08 uint16  program number
+//	0x0a uint8   flags
+//	0x0c [100]   name (UTF-16BE or UTF-8, zero-padded)
+//
+// Integers are little-endian.
+const (
+	channelListHeaderSize = 4
+	channelRecordSize     = 124
+	channelNameOffset     = 0x0c
+	channelNameSize       = 100
+)
+
+// Channel flags
+const (
+	channelFlagFavorite = 0x01
+	channelFlagHidden   = 0x04
+)
+
+// channelTypes maps the channel type codes to the MainTVAgent2 types
+var channelTypes = map[uint16]string{
+	0: "ATV", 1: "DTV", 2: "CATV", 3: "CDTV",
+	4: "PATV", 5: "PDTV", 6: "SATV", 7: "SDTV",
+}
+
+// ChannelList is the channel list of the TV
+type ChannelList struct {
+	Version     string      `json:"version,omitempty"`
+	Type        string      `json:"type,omitempty"`
+	SatelliteID string      `json:"satellite_id,omitempty"`
+	Channels    []TVChannel `json:"channels"`
+}
+
+// ChannelListInfo contains the channel list location returned by the TV
+type ChannelListInfo struct {
+	URL         string
+	Version     string
+	Type        string
+	SatelliteID string
+}
+
+// ChannelListInfo returns the location and version of the channel list
+func (a *MainTVAgent) ChannelListInfo() (ChannelListInfo, error) {
+	var info ChannelListInfo
+	out, err := a.call("GetChannelListURL")
+	if err != nil {
+		return info, err
+	}
+	info = ChannelListInfo{
+		URL:     out["ChannelListURL"],
+		Version: out["ChannelListVersion"],
+		Type:    out["ChannelListType"],
+
+		SatelliteID: out["SatelliteID"],
+	}
+	if info.URL == "" {
+		return info, errors.New("no channel list URL")
+	}
+	return info, nil
+}
+
+// ChannelList downloads and decodes the channel list
+func (a *MainTVAgent) ChannelList() (*ChannelList, error) {
+	info, err := a.ChannelListInfo()
+	if err != nil {
+		return nil, err
+	}
+	return DownloadChannelList(info)
+}
+
+// DownloadChannelList downloads and decodes the channel list
+func DownloadChannelList(info ChannelListInfo) (*ChannelList, error) {
+	client := &http.Client{Timeout: soapTimeout}
+	resp, err := client.Get(info.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not send request")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected response: %s", resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read channel list")
+	}
+
+	channels, err := ParseChannelList(data)
+	if err != nil {
+		return nil, err
+	}
+	return &ChannelList{
+		Version:     info.Version,
+		Type:        info.Type,
+		SatelliteID: info.SatelliteID,
+		Channels:    channels,
+	}, nil
+}
+
+// ParseChannelList decodes a binary channel list
+// Empty and hidden records are skipped.
+func ParseChannelList(data []byte) ([]TVChannel, error) {
+	if len(data) < channelListHeaderSize {
+		return nil, errors.New("channel list too short")
+	}
+	data = data[channelListHeaderSize:]
+	if len(data)%channelRecordSize != 0 {
+		return nil, errors.Errorf("invalid channel list size (%d bytes)", len(data))
+	}
+
+	var channels []TVChannel
+	for len(data) > 0 {
+		r := data[:channelRecordSize]
+		data = data[channelRecordSize:]
+
+		flags := r[0x0a]
+		ch := TVChannel{
+			Type:     channelTypes[binary.LittleEndian.Uint16(r[0x00:])],
+			Major:    int(binary.LittleEndian.Uint16(r[0x02:])),
+			Minor:    int(binary.LittleEndian.Uint16(r[0x04:])),
+			PTC:      int(binary.LittleEndian.Uint16(r[0x06:])),
+			ProgNum:  int(binary.LittleEndian.Uint16(r[0x08:])),
+			Name:     decodeChannelName(r[channelNameOffset : channelNameOffset+channelNameSize]),
+			Favorite: flags&channelFlagFavorite != 0,
+		}
+		if ch.Major == 0 || flags&channelFlagHidden != 0 {
+			continue
+		}
+		channels = append(channels, ch)
+	}
+	return channels, nil
+}
+
+// decodeChannelName decodes a zero-padded channel name
+// Samsung lists use UTF-16BE names; UTF-8 is used otherwise.
+func decodeChannelName(b []byte) string {
+	if len(b) >= 2 && b[0] == 0 && b[1] != 0 {
+		u := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			c := binary.BigEndian.Uint16(b[i:])
+			if c == 0 {
+				break
+			}
+			u = append(u, c)
+		}
+		return strings.TrimSpace(string(utf16.Decode(u)))
+	}
+	if i := strings.IndexByte(string(b), 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
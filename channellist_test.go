@@ -0,0 +1,70 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestParseChannelList(t *testing.T) {
+	// Synthetic H/J list following the record layout, with anonymised
+	// names: UTF-16BE and UTF-8 names, a favourite, a hidden channel and
+	// an empty record.
+	fixture, err := ioutil.ReadFile("testdata/channellist.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := fixture[:channelListHeaderSize]
+
+	want := []TVChannel{
+		{Type: "DTV", Major: 1, PTC: 21, ProgNum: 1001, Name: "Channel One", Favorite: true},
+		{Type: "DTV", Major: 2, PTC: 21, ProgNum: 1002, Name: "Channel Two HD"},
+		{Type: "CDTV", Major: 5, Minor: 1, PTC: 33, ProgNum: 2001, Name: "Cable Five"},
+		{Type: "ATV", Major: 12, PTC: 12, Name: "Télé Douze"},
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []TVChannel
+		wantErr bool
+	}{
+		{"fixture", fixture, want, false},
+		{"header only", header, nil, false},
+		{"one record", fixture[:channelListHeaderSize+channelRecordSize], want[:1], false},
+		{"empty", nil, nil, true},
+		{"short header", header[:2], nil, true},
+		{"truncated record", fixture[:len(fixture)-1], nil, true},
+		{"partial record", fixture[:channelListHeaderSize+channelNameOffset], nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseChannelList(tt.data)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/McKael/samtv"
+)
+
+// defaultApps contains the built-in application names
+var defaultApps = map[string]string{
+	"youtube": "YouTube",
+	"netflix": "Netflix",
+}
+
+var appPayload *string
+
+// appCmd represents the app command
+var appCmd = &cobra.Command{
+	Use:   "app",
+	Short: "Manage TV applications",
+	Long: `This command can be used to query, launch and stop TV applications
+using the DIAL protocol.
+
+The application can be given with its DIAL name (e.g. "YouTube") or with
+a friendly name defined in the "apps" section of the configuration file or
+of the TV profile.`,
+	Example: `  samtvcli app list
+  samtvcli app status youtube
+  samtvcli app launch youtube --payload v=dQw4w9WgXcQ
+  samtvcli app stop youtube`,
+}
+
+// appListCmd represents the app list command
+var appListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the application names",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		apps := getApps(currentTV)
+		names := make([]string, 0, len(apps))
+		for name := range apps {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tDIAL APPLICATION")
+		for _, name := range names {
+			fmt.Fprintf(w, "%s\t%s\n", name, apps[name])
+		}
+		w.Flush()
+	},
+}
+
+// appStatusCmd represents the app status command
+var appStatusCmd = &cobra.Command{
+	Use:   "status NAME",
+	Short: "Display the state of an application",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		app, err := newDIALClient().AppStatus(appName(args[0]))
+		if err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+		fmt.Println("Name:      ", app.Name)
+		fmt.Println("State:     ", app.State)
+		fmt.Println("Allow stop:", app.AllowStop)
+		if app.InstanceURL != "" {
+			fmt.Println("Instance:  ", app.InstanceURL)
+		}
+		if app.AdditionalData != "" {
+			fmt.Println("Data:      ", app.AdditionalData)
+		}
+	},
+}
+
+// appLaunchCmd represents the app launch command
+var appLaunchCmd = &cobra.Command{
+	Use:   "launch NAME",
+	Short: "Launch an application",
+	Long: `Launch an application.
+
+The payload is passed to the application, e.g. "v=VIDEO_ID" to play a
+YouTube video.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		instance, err := newDIALClient().Launch(appName(args[0]), *appPayload)
+		if err != nil {
+			logrus.Error("Cannot launch application: ", err)
+			os.Exit(1)
+		}
+		logrus.Debug("Application instance: ", instance)
+	},
+}
+
+// appStopCmd represents the app stop command
+var appStopCmd = &cobra.Command{
+	Use:   "stop NAME",
+	Short: "Stop an application",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := newDIALClient().Stop(appName(args[0])); err != nil {
+			logrus.Error("Cannot stop application: ", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(appCmd)
+	appCmd.AddCommand(appListCmd)
+	appCmd.AddCommand(appStatusCmd)
+	appCmd.AddCommand(appLaunchCmd)
+	appCmd.AddCommand(appStopCmd)
+
+	appPayload = appLaunchCmd.Flags().String("payload", "", "Launch payload")
+
+	for _, c := range []*cobra.Command{appStatusCmd, appLaunchCmd, appStopCmd} {
+		c.ValidArgsFunction = completeAppNames
+	}
+}
+
+// newDIALClient returns a DIAL client for the selected TV
+func newDIALClient() *samtv.DIALClient {
+	c, err := samtv.NewTVDIALClient(server, tvPorts)
+	if err != nil {
+		logrus.Error(err)
+		os.Exit(1)
+	}
+	return c
+}
+
+// getApps returns the application names for the given TV profile
+// The built-in names can be overridden in the "apps" section of the
+// configuration file or of the TV profile.
+func getApps(p *tvProfile) map[string]string {
+	apps := make(map[string]string)
+	for name, app := range defaultApps {
+		apps[name] = app
+	}
+	for name, app := range viper.GetStringMapString("apps") {
+		apps[name] = app
+	}
+	if p != nil {
+		for name, app := range p.Apps {
+			apps[strings.ToLower(name)] = app
+		}
+	}
+	return apps
+}
+
+// appName returns the DIAL name of an application
+func appName(name string) string {
+	if app, ok := getApps(currentTV)[strings.ToLower(name)]; ok {
+		logrus.Debugf("Application '%s' is '%s'", name, app)
+		return app
+	}
+	return name
+}
+
+// completeAppNames provides shell completion for the application names
+func completeAppNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	loadCompletionConfig()
+
+	var names []string
+	for name := range getApps(nil) {
+		if strings.HasPrefix(name, strings.ToLower(toComplete)) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
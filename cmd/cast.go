@@ -0,0 +1,403 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/McKael/samtv"
+)
+
+// castPollInterval is the delay between position updates
+const castPollInterval = 2 * time.Second
+
+// Media types that are not always known by the system
+var castMediaTypes = map[string]string{
+	".mkv":  "video/x-matroska",
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".avi":  "video/x-msvideo",
+	".ts":   "video/mp2t",
+	".webm": "video/webm",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".flac": "audio/flac",
+	".ogg":  "audio/ogg",
+	".wav":  "audio/wav",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+}
+
+var castFollow *bool
+var castListen *string
+var castMIMEType *string
+
+// castCmd represents the cast command
+var castCmd = &cobra.Command{
+	Use:   "cast FILE|URL",
+	Short: "Play a media file or URL on the TV",
+	Long: `Play a media file or URL on the TV, using the UPnP AVTransport service.
+
+Local files are served by a built-in HTTP server; the command runs until
+the playback ends, and stops the playback when it is interrupted.  The
+playback position is displayed.
+
+The pause, play, seek, stop and position subcommands control the current
+playback.`,
+	Example: `  samtvcli cast movie.mkv
+  samtvcli cast https://example.com/video.mp4 --follow
+  samtvcli cast pause
+  samtvcli cast seek 1:05:00
+  samtvcli cast seek +30s
+  samtvcli cast position`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		t := newAVTransport()
+
+		target := args[0]
+		var srv *http.Server
+		if !isMediaURL(target) {
+			var err error
+			srv, target, err = serveMediaFile(target)
+			if err != nil {
+				logrus.Error(err)
+				os.Exit(1)
+			}
+			defer srv.Close()
+		}
+
+		mimeType := *castMIMEType
+		if mimeType == "" {
+			mimeType = mediaType(target)
+		}
+		title := filepath.Base(args[0])
+		logrus.Debugf("Casting %s (%s)", target, mimeType)
+
+		if err := t.SetURI(target, samtv.DIDLLite(title, target, mimeType)); err != nil {
+			logrus.Error("Cannot set media: ", err)
+			os.Exit(1)
+		}
+		if err := t.Play(); err != nil {
+			logrus.Error("Cannot start playback: ", err)
+			os.Exit(1)
+		}
+
+		if srv != nil || *castFollow {
+			if err := followPlayback(t, srv != nil); err != nil {
+				logrus.Error(err)
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+// castPauseCmd represents the cast pause command
+var castPauseCmd = &cobra.Command{
+	Use:   "pause",
+	Short: "Pause the playback",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError(newAVTransport().Pause())
+	},
+}
+
+// castPlayCmd represents the cast play command
+var castPlayCmd = &cobra.Command{
+	Use:   "play",
+	Short: "Resume the playback",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError(newAVTransport().Play())
+	},
+}
+
+// castStopCmd represents the cast stop command
+var castStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the playback",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnError(newAVTransport().Stop())
+	},
+}
+
+// castSeekCmd represents the cast seek command
+var castSeekCmd = &cobra.Command{
+	Use:   "seek POSITION|+DURATION|-DURATION",
+	Short: "Move to a position",
+	Long: `Move to a position in the current media.
+
+The position can be given as H:MM:SS, MM:SS or as a duration (e.g. 90s).
+Relative positions start with a sign; use "--" before a negative value.`,
+	Example: `  samtvcli cast seek 1:05:00
+  samtvcli cast seek +30s
+  samtvcli cast seek -- -1m`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		t := newAVTransport()
+		arg := args[0]
+		relative := strings.HasPrefix(arg, "+") || strings.HasPrefix(arg, "-")
+		pos, err := parsePosition(strings.TrimLeft(arg, "+-"))
+		if err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+		if relative {
+			p, err := t.Position()
+			exitOnError(err)
+			if strings.HasPrefix(arg, "-") {
+				pos = -pos
+			}
+			pos += p.Position
+		}
+		exitOnError(t.Seek(pos))
+	},
+}
+
+// castPositionCmd represents the cast position command
+var castPositionCmd = &cobra.Command{
+	Use:   "position",
+	Short: "Display the playback position",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		t := newAVTransport()
+		if *castFollow {
+			exitOnError(followPlayback(t, false))
+			return
+		}
+		state, err := t.State()
+		exitOnError(err)
+		p, err := t.Position()
+		exitOnError(err)
+		printPosition(state, p)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(castCmd)
+	castCmd.AddCommand(castPauseCmd)
+	castCmd.AddCommand(castPlayCmd)
+	castCmd.AddCommand(castStopCmd)
+	castCmd.AddCommand(castSeekCmd)
+	castCmd.AddCommand(castPositionCmd)
+
+	castFollow = castCmd.PersistentFlags().Bool("follow", false, "Display the position until the playback ends")
+	castListen = castCmd.Flags().String("listen", "", "Local address of the media server (default: automatic)")
+	castMIMEType = castCmd.Flags().String("mime-type", "", "Media type (default: from the file extension)")
+}
+
+// exitOnError logs the error and exits if err is not nil
+func exitOnError(err error) {
+	if err != nil {
+		logrus.Error(err)
+		os.Exit(1)
+	}
+}
+
+// newAVTransport returns an AVTransport client for the selected TV
+func newAVTransport() *samtv.AVTransport {
+	t, err := samtv.NewAVTransport(server, tvPorts)
+	if err != nil {
+		logrus.Error("Cannot find the TV media renderer: ", err)
+		os.Exit(1)
+	}
+	return t
+}
+
+// isMediaURL returns true if the argument is a HTTP URL
+func isMediaURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// mediaType returns the MIME type of a media file or URL
+func mediaType(name string) string {
+	if u, err := url.Parse(name); err == nil {
+		name = u.Path
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, ok := castMediaTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// serveMediaFile starts a HTTP server for a local file and returns the
+// URL of the file
+// The server listens on the local address used to reach the TV.
+func serveMediaFile(path string) (*http.Server, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "cannot open media file")
+	}
+	fi, err := f.Stat()
+	f.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	if fi.IsDir() {
+		return nil, "", errors.New("cannot cast a directory")
+	}
+
+	listen := *castListen
+	if listen == "" {
+		ip, err := localAddressFor(server)
+		if err != nil {
+			return nil, "", err
+		}
+		listen = net.JoinHostPort(ip, "0")
+	}
+	l, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "cannot start media server")
+	}
+
+	name := filepath.Base(path)
+	mimeType := mediaType(name)
+	if *castMIMEType != "" {
+		mimeType = *castMIMEType
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/media/", func(w http.ResponseWriter, r *http.Request) {
+		logrus.Debugf("Media request from %s: %s %s (Range: %s)",
+			r.RemoteAddr, r.Method, r.URL.Path, r.Header.Get("Range"))
+		f, err := os.Open(path)
+		if err != nil {
+			http.Error(w, "cannot open file", http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+		w.Header().Set("Content-Type", mimeType)
+		w.Header().Set("transferMode.dlna.org", "Streaming")
+		w.Header().Set("contentFeatures.dlna.org",
+			"DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=01700000000000000000000000000000")
+		// ServeContent handles the range requests
+		http.ServeContent(w, r, name, fi.ModTime(), f)
+	})
+
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			logrus.Error("Media server error: ", err)
+		}
+	}()
+
+	u := "http://" + l.Addr().String() + "/media/" + url.PathEscape(name)
+	logrus.Info("Serving media file at ", u)
+	return srv, u, nil
+}
+
+// localAddressFor returns the local IP address used to reach the host
+func localAddressFor(host string) (string, error) {
+	conn, err := net.Dial("udp", net.JoinHostPort(host, "1900"))
+	if err != nil {
+		return "", errors.Wrap(err, "cannot find the local address")
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
+
+// followPlayback displays the position until the playback ends
+// If stopOnInterrupt is true, the playback is stopped when the command is
+// interrupted.
+func followPlayback(t *samtv.AVTransport, stopOnInterrupt bool) error {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	ticker := time.NewTicker(castPollInterval)
+	defer ticker.Stop()
+
+	started := false
+	for {
+		select {
+		case <-interrupt:
+			if stopOnInterrupt {
+				logrus.Info("Stopping playback")
+				return t.Stop()
+			}
+			return nil
+		case <-ticker.C:
+		}
+
+		state, err := t.State()
+		if err != nil {
+			return err
+		}
+		switch state {
+		case samtv.TransportPlaying, samtv.TransportPaused:
+			started = true
+		case samtv.TransportStopped, samtv.TransportNoMedia:
+			if started {
+				logrus.Info("Playback ended")
+				return nil
+			}
+		}
+		p, err := t.Position()
+		if err != nil {
+			return err
+		}
+		printPosition(state, p)
+	}
+}
+
+// printPosition displays the transport state and the playback position
+func printPosition(state string, p samtv.TransportPosition) {
+	fmt.Printf("%s %s / %s\n", state,
+		samtv.FormatUPnPDuration(p.Position), samtv.FormatUPnPDuration(p.Duration))
+}
+
+// parsePosition parses a position given as H:MM:SS, MM:SS or as a duration
+func parsePosition(s string) (time.Duration, error) {
+	switch strings.Count(s, ":") {
+	case 1:
+		s = "0:" + s
+		fallthrough
+	case 2:
+		return samtv.ParseUPnPDuration(s)
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.Errorf("invalid position '%s'", s)
+	}
+	return d, nil
+}
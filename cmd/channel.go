@@ -0,0 +1,307 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/McKael/samtv"
+)
+
+// channelTiming contains the delays used to type a channel number
+type channelTiming struct {
+	key   time.Duration // Delay between the digits
+	enter time.Duration // Delay before KEY_ENTER
+}
+
+// defaultChannelTimings contains the default delays for the models of
+// each backend; the older models need more time to handle the digits
+var defaultChannelTimings = map[string]channelTiming{
+	samtv.LegacyBackend:    {500 * time.Millisecond, 800 * time.Millisecond},
+	samtv.SmartViewBackend: {300 * time.Millisecond, 500 * time.Millisecond},
+	samtv.TizenBackend:     {200 * time.Millisecond, 300 * time.Millisecond},
+}
+
+var channelUseKeys *bool
+
+// channelCmd represents the channel command
+var channelCmd = &cobra.Command{
+	Use:   "channel NUMBER|NAME",
+	Short: "Tune a channel",
+	Long: `Tune a channel by number ("123" or "5-1") or by name.
+
+Names are looked up in the "lineup" list of the configuration file or of
+the TV profile (name and number items), and in the channel list of the TV
+(see the channels command); close names are accepted when they are not
+ambiguous.
+
+If the TV supports it (H/J models), the channel is tuned directly;
+otherwise the number is typed with the digit keys, followed by KEY_ENTER.
+The delays between the keys depend on the model year (see the detect
+command) or on the backend, and can be set with the channel_key_delay and
+channel_enter_delay items.`,
+	Example: `  samtvcli channel 123
+  samtvcli channel 5-1
+  samtvcli channel "BBC One"
+  samtvcli channel --keys 7`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := tuneChannel(strings.Join(args, " ")); err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(channelCmd)
+
+	channelUseKeys = channelCmd.Flags().Bool("keys", false, "Always use the digit keys")
+}
+
+// tuneChannel tunes a channel given by number or name
+func tuneChannel(arg string) error {
+	_, _, numErr := samtv.ParseChannelNumber(arg)
+	direct := !*channelUseKeys && directTuningSupported(currentTV)
+
+	// The channel list is not needed to type a channel number, and is
+	// only fetched from the TV if it can be used for direct tuning
+	var list *samtv.ChannelList
+	if numErr != nil || direct {
+		list = lineupChannelList(direct)
+	}
+
+	number := arg
+	if numErr != nil {
+		ch, err := resolveChannelName(arg, list)
+		if err != nil {
+			return err
+		}
+		number = ch.Number()
+		logrus.Infof("Tuning %s (%s)", ch.Name, number)
+	}
+
+	// Direct tuning requires the channel details from the TV list
+	if direct && list != nil {
+		if ch, ok := samtv.FindChannelNumber(list.Channels, number); ok && ch.Type != "" {
+			err := tuneChannelDirect(ch, list)
+			if err == nil {
+				return nil
+			}
+			logrus.Debug("Direct tuning failed: ", err)
+		}
+	}
+
+	keys, err := samtv.ChannelKeys(number)
+	if err != nil {
+		return err
+	}
+	timing := getChannelTiming(currentTV)
+	logrus.Debugf("Typing channel %s: %v", number, keys)
+	return runWithSession(func(s samtv.Backend) error {
+		for i, k := range keys {
+			if i > 0 {
+				if k == "KEY_ENTER" {
+					time.Sleep(timing.enter)
+				} else {
+					time.Sleep(timing.key)
+				}
+			}
+			if err := s.Key(k); err != nil {
+				return errors.Wrapf(err, "cannot send key '%s'", k)
+			}
+		}
+		return nil
+	})
+}
+
+// tuneChannelDirect tunes a channel with the TV agent service
+func tuneChannelDirect(ch samtv.TVChannel, list *samtv.ChannelList) error {
+	a, err := samtv.NewMainTVAgent(server, tvPorts)
+	if err != nil {
+		return err
+	}
+	if err := a.SetChannel(ch, list.Type, list.SatelliteID); err != nil {
+		return err
+	}
+	logrus.Debugf("Tuned channel %s directly", ch.Number())
+	return nil
+}
+
+// lineupChannelList returns the channel list of the TV from the cache if
+// available, or nil.  If fetch is true, the list is requested from the TV
+// when it is not cached.
+func lineupChannelList(fetch bool) *samtv.ChannelList {
+	if c, err := loadChannelCache(); err == nil {
+		return &c.ChannelList
+	}
+	if !fetch {
+		return nil
+	}
+	list, err := getChannelList(false)
+	if err != nil {
+		logrus.Debug("No channel list: ", err)
+		return nil
+	}
+	return list
+}
+
+// resolveChannelName finds a channel by name in the configured lineup and
+// in the TV channel list
+func resolveChannelName(name string, list *samtv.ChannelList) (samtv.TVChannel, error) {
+	var lineup []samtv.TVChannel
+	for _, e := range getLineup(currentTV) {
+		major, minor, err := samtv.ParseChannelNumber(e.Number)
+		if err != nil {
+			logrus.Warnf("Invalid number for channel '%s' in the lineup: %v", e.Name, err)
+			continue
+		}
+		lineup = append(lineup, samtv.TVChannel{
+			Name:     e.Name,
+			Major:    major,
+			Minor:    minor,
+			Favorite: e.Favorite,
+		})
+	}
+
+	// The configured lineup has precedence
+	matches := samtv.FindChannelName(lineup, name)
+	if len(matches) == 0 && list != nil {
+		matches = samtv.FindChannelName(list.Channels, name)
+	}
+
+	switch len(matches) {
+	case 0:
+		return samtv.TVChannel{}, errors.Errorf("unknown channel '%s'", name)
+	case 1:
+		return matches[0], nil
+	}
+	// Several channels with the same name and number are not ambiguous
+	var names []string
+	for _, m := range matches {
+		if m.Number() != matches[0].Number() {
+			for _, m := range matches {
+				names = append(names, m.Name+" ("+m.Number()+")")
+			}
+			return samtv.TVChannel{}, errors.Errorf("ambiguous channel name '%s': %s",
+				name, strings.Join(names, ", "))
+		}
+	}
+	return matches[0], nil
+}
+
+// lineupEntry is a channel of the configured lineup
+// The lineup is a list rather than a mapping, since Viper would split the
+// names containing dots.
+type lineupEntry struct {
+	Name     string `mapstructure:"name" yaml:"name"`
+	Number   string `mapstructure:"number" yaml:"number"`
+	Favorite bool   `mapstructure:"favorite" yaml:"favorite,omitempty"`
+}
+
+// getLineup returns the configured channel lineup
+// The channels of the global lineup can be overridden in the TV profile.
+func getLineup(p *tvProfile) []lineupEntry {
+	var lineup []lineupEntry
+	if err := viper.UnmarshalKey("lineup", &lineup); err != nil {
+		logrus.Warn("Cannot parse the lineup: ", err)
+	}
+	if p != nil {
+		lineup = mergeLineup(lineup, p.Lineup)
+	}
+	return lineup
+}
+
+// mergeLineup returns the lineup updated with the given channels
+// Existing channels with the same name are replaced.
+func mergeLineup(lineup, channels []lineupEntry) []lineupEntry {
+	for _, c := range channels {
+		found := false
+		for i := range lineup {
+			if strings.EqualFold(lineup[i].Name, c.Name) {
+				lineup[i], found = c, true
+				break
+			}
+		}
+		if !found {
+			lineup = append(lineup, c)
+		}
+	}
+	return lineup
+}
+
+// getModelYear returns the model year of the TV, or 0 if unknown
+func getModelYear(p *tvProfile) int {
+	if p != nil && p.ModelYear > 0 {
+		return p.ModelYear
+	}
+	return viper.GetInt("model_year")
+}
+
+// modelBackend returns the backend of the TV model generation, from the
+// model year if known, or the configured backend
+func modelBackend(p *tvProfile) string {
+	if b := samtv.BackendForYear(getModelYear(p)); b != "" {
+		return b
+	}
+	return backendName(tvBackend)
+}
+
+// directTuningSupported returns true if the channels can be tuned with the
+// TV agent service, i.e. if the TV is known to be a H/J model (from the
+// model year or the configured backend)
+func directTuningSupported(p *tvProfile) bool {
+	if year := getModelYear(p); year > 0 {
+		return samtv.BackendForYear(year) == samtv.SmartViewBackend
+	}
+	return tvBackend == samtv.SmartViewBackend
+}
+
+// getChannelTiming returns the delays used to type a channel number
+func getChannelTiming(p *tvProfile) channelTiming {
+	t, ok := defaultChannelTimings[modelBackend(p)]
+	if !ok {
+		t = defaultChannelTimings[samtv.SmartViewBackend]
+	}
+
+	if d := viper.GetDuration("channel_key_delay"); d > 0 {
+		t.key = d
+	}
+	if d := viper.GetDuration("channel_enter_delay"); d > 0 {
+		t.enter = d
+	}
+	if p != nil {
+		if p.ChannelKeyDelay > 0 {
+			t.key = p.ChannelKeyDelay
+		}
+		if p.ChannelEnterDelay > 0 {
+			t.enter = p.ChannelEnterDelay
+		}
+	}
+	return t
+}
@@ -0,0 +1,208 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/McKael/samtv"
+)
+
+var channelMsgName *string
+var channelMsgTo *string
+var channelMsgTimeout *time.Duration
+
+// channelMsgCmd represents the channel-msg command
+var channelMsgCmd = &cobra.Command{
+	Use:   "channel-msg",
+	Short: "Exchange messages with a TV application",
+	Long: `This command can be used to exchange messages with a TV application
+through a MultiScreen channel.
+
+The channel identifier is defined by the TV application.  Events are
+sent with a name and optional data; the data argument is sent as JSON if
+it is valid JSON, otherwise as a string.  Received events are displayed
+as JSON lines.`,
+	Example: `  samtvcli channel-msg clients com.example.app
+  samtvcli channel-msg send com.example.app say '{"text":"Hello"}'
+  samtvcli channel-msg send --to all com.example.app refresh
+  samtvcli channel-msg broadcast com.example.app ping
+  samtvcli channel-msg listen --timeout 1m com.example.app`,
+}
+
+// channelMsgClientsCmd represents the channel-msg clients command
+var channelMsgClientsCmd = &cobra.Command{
+	Use:   "clients CHANNEL",
+	Short: "List the clients connected to a channel",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ch := openChannel(args[0])
+		defer ch.Close()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tHOST\tCONNECTED")
+		for _, c := range ch.Clients() {
+			host := "no"
+			if c.IsHost {
+				host = "yes"
+			}
+			if c.ID == ch.ClientID() {
+				host = "(self)"
+			}
+			t := time.Unix(c.ConnectTime/1000, 0).Format(time.RFC3339)
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.ID, host, t)
+		}
+		w.Flush()
+	},
+}
+
+// channelMsgSendCmd represents the channel-msg send command
+var channelMsgSendCmd = &cobra.Command{
+	Use:   "send CHANNEL EVENT [DATA]",
+	Short: "Send an event to a channel client",
+	Long: `Send an event to a channel client.
+
+By default the event is sent to the TV application; the target can be
+set with --to (a client ID, "host", "all" or "broadcast").`,
+	Args: cobra.RangeArgs(2, 3),
+	Run: func(cmd *cobra.Command, args []string) {
+		sendChannelEvent(args, *channelMsgTo)
+	},
+}
+
+// channelMsgBroadcastCmd represents the channel-msg broadcast command
+var channelMsgBroadcastCmd = &cobra.Command{
+	Use:   "broadcast CHANNEL EVENT [DATA]",
+	Short: "Send an event to all the other channel clients",
+	Args:  cobra.RangeArgs(2, 3),
+	Run: func(cmd *cobra.Command, args []string) {
+		sendChannelEvent(args, samtv.MultiScreenBroadcast)
+	},
+}
+
+// channelMsgListenCmd represents the channel-msg listen command
+var channelMsgListenCmd = &cobra.Command{
+	Use:   "listen CHANNEL",
+	Short: "Display the events received on a channel",
+	Long: `Display the events received on a channel, as JSON lines.
+
+The command runs until it is interrupted, or until the --timeout delay.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ch := openChannel(args[0])
+		defer ch.Close()
+
+		var timeout <-chan time.Time
+		if *channelMsgTimeout > 0 {
+			timeout = time.After(*channelMsgTimeout)
+		}
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+
+		for {
+			select {
+			case ev, ok := <-ch.Events():
+				if !ok {
+					if err := ch.Err(); err != nil {
+						logrus.Error(err)
+						os.Exit(1)
+					}
+					return
+				}
+				out := struct {
+					samtv.MultiScreenEvent
+					Client *samtv.MultiScreenClient `json:"client,omitempty"`
+				}{ev, ev.Client}
+				b, _ := json.Marshal(out)
+				fmt.Printf("%s\n", b)
+			case <-timeout:
+				return
+			case <-interrupt:
+				return
+			}
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(channelMsgCmd)
+	channelMsgCmd.AddCommand(channelMsgClientsCmd)
+	channelMsgCmd.AddCommand(channelMsgSendCmd)
+	channelMsgCmd.AddCommand(channelMsgBroadcastCmd)
+	channelMsgCmd.AddCommand(channelMsgListenCmd)
+
+	channelMsgName = channelMsgCmd.PersistentFlags().String("name", "", "Client name (default: the app_id item)")
+	channelMsgTo = channelMsgSendCmd.Flags().String("to", samtv.MultiScreenHost, "Event target")
+	channelMsgTimeout = channelMsgListenCmd.Flags().Duration("timeout", 0, "Stop listening after this delay")
+}
+
+// openChannel connects to a MultiScreen channel of the selected TV
+// The access token of the Tizen backend is used if available.
+func openChannel(id string) *samtv.MultiScreenChannel {
+	c, err := loadCredentials()
+	if err != nil {
+		logrus.Error(err)
+		os.Exit(1)
+	}
+	name := *channelMsgName
+	if name == "" {
+		name = c.AppID
+	}
+
+	ch, err := samtv.OpenMultiScreenChannel(id, samtv.MultiScreenChannelOptions{
+		Address: server,
+		Ports:   tvPorts,
+		Name:    name,
+		Token:   c.Token,
+	})
+	if err != nil {
+		logrus.Error("Cannot open channel: ", err)
+		os.Exit(1)
+	}
+	return ch
+}
+
+// sendChannelEvent sends the event given in the command arguments
+func sendChannelEvent(args []string, to string) {
+	var data interface{}
+	if len(args) > 2 {
+		if json.Valid([]byte(args[2])) {
+			data = json.RawMessage(args[2])
+		} else {
+			data = args[2]
+		}
+	}
+
+	ch := openChannel(args[0])
+	defer ch.Close()
+	if err := ch.Send(args[1], data, to); err != nil {
+		logrus.Error("Cannot send event: ", err)
+		os.Exit(1)
+	}
+}
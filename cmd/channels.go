@@ -0,0 +1,214 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/McKael/samtv"
+)
+
+var channelsFormat *string
+var channelsRefresh *bool
+
+// cachedChannelList is the format of the channel list cache file
+type cachedChannelList struct {
+	Updated time.Time `json:"updated"`
+	samtv.ChannelList
+}
+
+// channelsCmd represents the channels command
+var channelsCmd = &cobra.Command{
+	Use:   "channels",
+	Short: "Manage the TV channel list",
+	Long: `This command can be used to display the TV channel list.
+
+The list is downloaded from the TV (H/J models) and cached for each TV
+profile; it is downloaded again when the TV reports a new version.  The
+cached list is used when the TV is not reachable.`,
+}
+
+// channelsListCmd represents the channels list command
+var channelsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Display the channel list",
+	Long: `Display the channel list of the TV.
+
+The M3U output can be used to edit or share the channel names and numbers;
+the entries have placeholder samtv://channel/NUMBER locations, since the
+TV does not stream the channels: they cannot be opened by a media player.`,
+	Example: `  samtvcli channels list
+  samtvcli channels list --format json
+  samtvcli channels list --format m3u > channels.m3u
+  samtvcli channels list --refresh`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		list, err := getChannelList(*channelsRefresh)
+		if err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+		if err := printChannelList(list, *channelsFormat); err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(channelsCmd)
+	channelsCmd.AddCommand(channelsListCmd)
+
+	channelsFormat = channelsListCmd.Flags().String("format", "text", "Output format (text, json or m3u)")
+	channelsRefresh = channelsListCmd.Flags().Bool("refresh", false, "Download the list even if it has not changed")
+	channelsListCmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"text", "json", "m3u"}, cobra.ShellCompDirectiveNoFileComp
+	})
+}
+
+// getChannelList returns the channel list of the selected TV
+// The cached list is used if the TV list has not changed, or if the TV is
+// not reachable.
+func getChannelList(refresh bool) (*samtv.ChannelList, error) {
+	cached, cacheErr := loadChannelCache()
+	if cacheErr != nil && !os.IsNotExist(errors.Cause(cacheErr)) {
+		logrus.Warn("Cannot read the channel list cache: ", cacheErr)
+	}
+
+	a, err := samtv.NewMainTVAgent(server, tvPorts)
+	var info samtv.ChannelListInfo
+	if err == nil {
+		info, err = a.ChannelListInfo()
+	}
+	if err != nil {
+		if cached != nil {
+			logrus.Infof("Using the cached channel list (%s): %v",
+				cached.Updated.Format("2006-01-02 15:04"), err)
+			return &cached.ChannelList, nil
+		}
+		return nil, errors.Wrap(err, "cannot get the channel list")
+	}
+
+	if cached != nil && !refresh && info.Version != "" && cached.Version == info.Version {
+		logrus.Debug("Using the cached channel list, version ", info.Version)
+		return &cached.ChannelList, nil
+	}
+
+	list, err := samtv.DownloadChannelList(info)
+	if err != nil {
+		if cached != nil {
+			logrus.Infof("Using the cached channel list (%s): %v",
+				cached.Updated.Format("2006-01-02 15:04"), err)
+			return &cached.ChannelList, nil
+		}
+		return nil, errors.Wrap(err, "cannot get the channel list")
+	}
+	logrus.Debugf("Downloaded %d channels (version %s)", len(list.Channels), list.Version)
+	if err := saveChannelCache(list); err != nil {
+		logrus.Warn("Cannot save the channel list cache: ", err)
+	}
+	return list, nil
+}
+
+// channelCachePath returns the path of the channel list cache file of the
+// selected TV
+func channelCachePath() (string, error) {
+	return profileCachePath("channels", ".json")
+}
+
+func loadChannelCache() (*cachedChannelList, error) {
+	path, err := channelCachePath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c cachedChannelList
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, errors.Wrap(err, "cannot parse cache file")
+	}
+	return &c, nil
+}
+
+func saveChannelCache(list *samtv.ChannelList) error {
+	path, err := channelCachePath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cachedChannelList{
+		Updated:     time.Now(),
+		ChannelList: *list,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writePrivateFile(path, data)
+}
+
+// printChannelList displays the channel list in the given format
+func printChannelList(list *samtv.ChannelList, format string) error {
+	switch strings.ToLower(format) {
+	case "", "text":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  NUMBER\tNAME\tTYPE")
+		for _, ch := range list.Channels {
+			fav := " "
+			if ch.Favorite {
+				fav = "*"
+			}
+			fmt.Fprintf(w, "%s %s\t%s\t%s\n", fav, ch.Number(), ch.Name, ch.Type)
+		}
+		return w.Flush()
+	case "json":
+		b, err := json.MarshalIndent(list.Channels, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", b)
+		return nil
+	case "m3u":
+		fmt.Println("#EXTM3U")
+		for _, ch := range list.Channels {
+			group := ch.Type
+			if ch.Favorite {
+				group = "Favorites"
+			}
+			fmt.Printf("#EXTINF:-1 tvg-chno=\"%s\" group-title=\"%s\",%s\n",
+				ch.Number(), group, ch.Name)
+			// Placeholder location: the TV does not stream the channels
+			fmt.Printf("samtv://channel/%s\n", ch.Number())
+		}
+		return nil
+	}
+	return errors.Errorf("unknown format '%s'", format)
+}
@@ -0,0 +1,178 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/McKael/samtv"
+)
+
+var importList *string
+var importFavorites *bool
+var importDryRun *bool
+var importYes *bool
+
+// channelsImportCmd represents the channels import command
+var channelsImportCmd = &cobra.Command{
+	Use:   "import FILE.scm",
+	Short: "Import channel names from a TV channel list export",
+	Long: `Import the channel names from a channel list exported by the TV
+to a USB drive (.scm file).
+
+The parsed channels are displayed, then added to the "lineup" list of the
+configuration file (or of the selected TV profile) after confirmation,
+so that they can be tuned by name with the channel command.  The favorite
+channels are marked in the lineup.
+
+When the archive contains several lists (e.g. map-AirD and map-CableD),
+the list has to be selected with --list.`,
+	Example: `  samtvcli channels import channel_list_UE48JU6000.scm --dry-run
+  samtvcli channels import channel_list_UE48JU6000.scm --list CableD
+  samtvcli channels import channel_list_UE48JU6000.scm --favorites --yes`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := importChannels(args[0]); err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	channelsCmd.AddCommand(channelsImportCmd)
+
+	importList = channelsImportCmd.Flags().String("list", "", "Channel list to import (e.g. AirD or map-CableD)")
+	importFavorites = channelsImportCmd.Flags().Bool("favorites", false, "Only import the favorite channels")
+	importDryRun = channelsImportCmd.Flags().Bool("dry-run", false, "Display the channels without saving them")
+	importYes = channelsImportCmd.Flags().BoolP("yes", "y", false, "Save the channels without confirmation")
+}
+
+// importChannels imports the channel names of a .scm file to the lineup
+func importChannels(filename string) error {
+	lists, err := samtv.ReadSCMFile(filename)
+	if err != nil {
+		return errors.Wrap(err, "cannot read channel list file")
+	}
+	scm, err := selectSCMList(lists, *importList)
+	if err != nil {
+		return err
+	}
+
+	list := &samtv.ChannelList{Type: scm.Name}
+	for _, ch := range scm.Channels {
+		if ch.Name == "" || (*importFavorites && !ch.Favorite) {
+			continue
+		}
+		list.Channels = append(list.Channels, ch)
+	}
+	if len(list.Channels) == 0 {
+		return errors.Errorf("no channel to import from %s", scm.Name)
+	}
+
+	if err := printChannelList(list, "text"); err != nil {
+		return err
+	}
+	fmt.Printf("%d channels in %s\n", len(list.Channels), scm.Name)
+	if *importDryRun {
+		return nil
+	}
+	if !*importYes && !(isTerminal(os.Stdin) && confirm("Add these channels to the lineup?")) {
+		logrus.Info("The lineup has not been updated")
+		return nil
+	}
+	return saveLineup(list.Channels)
+}
+
+// selectSCMList returns the channel list with the given name
+// The name can be omitted if the archive contains a single list.
+func selectSCMList(lists []samtv.SCMList, name string) (samtv.SCMList, error) {
+	if name == "" {
+		if len(lists) == 1 {
+			return lists[0], nil
+		}
+		var names []string
+		for _, l := range lists {
+			names = append(names, fmt.Sprintf("%s (%d channels)", l.Name, len(l.Channels)))
+		}
+		return samtv.SCMList{}, errors.Errorf("several channel lists in the file, select one with --list: %s",
+			strings.Join(names, ", "))
+	}
+	for _, l := range lists {
+		if strings.EqualFold(l.Name, name) || strings.EqualFold(l.Name, "map-"+name) {
+			return l, nil
+		}
+	}
+	return samtv.SCMList{}, errors.Errorf("no channel list '%s' in the file", name)
+}
+
+// saveLineup adds the channels to the lineup of the configuration file
+// When several channels have the same name, the first one is kept; the
+// channels already in the lineup are updated.
+func saveLineup(channels []samtv.TVChannel) error {
+	path, err := configFilePath()
+	if err != nil {
+		return err
+	}
+	if err := backupFile(path); err != nil {
+		return errors.Wrap(err, "cannot backup configuration file")
+	}
+
+	var entries []lineupEntry
+	seen := make(map[string]bool)
+	for _, ch := range channels {
+		key := strings.ToLower(ch.Name)
+		if seen[key] {
+			logrus.Warnf("Duplicate channel name '%s', skipping %s", ch.Name, ch.Number())
+			continue
+		}
+		seen[key] = true
+		entries = append(entries, lineupEntry{
+			Name:     ch.Name,
+			Number:   ch.Number(),
+			Favorite: ch.Favorite,
+		})
+	}
+
+	// The lineup of the section is updated
+	var lineup []lineupEntry
+	var section []string
+	if currentTV != nil {
+		lineup = append([]lineupEntry{}, currentTV.Lineup...)
+		section = []string{"tvs", tvName}
+	} else if err := viper.UnmarshalKey("lineup", &lineup); err != nil {
+		return errors.Wrap(err, "cannot parse the lineup")
+	}
+	lineup = mergeLineup(lineup, entries)
+
+	if err := updateConfigFile(path, section, []configItem{{Key: "lineup", Value: lineup}}); err != nil {
+		return err
+	}
+	logrus.Infof("%d channels added to the lineup in '%s'", len(entries), path)
+	return nil
+}
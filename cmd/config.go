@@ -0,0 +1,170 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// configFilePath returns the path of the configuration file in use
+// If no configuration file was found, the default path is returned.
+func configFilePath() (string, error) {
+	if cfgFile == "/dev/null" {
+		return "", errors.New("no configuration file")
+	}
+	if p := viper.ConfigFileUsed(); p != "" {
+		return p, nil
+	}
+	if cfgFile != "" {
+		return cfgFile, nil
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", AppName, AppName+".yaml"), nil
+}
+
+// configItem is an item of the configuration file
+type configItem struct {
+	Key   string
+	Value interface{}
+}
+
+// updateConfigFile sets the given values in a section of the YAML
+// configuration file.  The section is a key path, e.g. ["tvs", "living"];
+// missing mappings are created.
+// The document is edited as a YAML node tree, so that the order of the
+// items, the comments and the formatting of the other items are preserved.
+func updateConfigFile(path string, section []string, values []configItem) error {
+	var doc yaml.Node
+
+	mode := os.FileMode(0600)
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		if fi, err := os.Stat(path); err == nil {
+			mode = fi.Mode()
+		}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return errors.Wrap(err, "cannot parse configuration file")
+		}
+	} else if !os.IsNotExist(err) {
+		return errors.Wrap(err, "cannot read configuration file")
+	}
+
+	if doc.Kind == 0 {
+		doc.Kind = yaml.DocumentNode
+	}
+	if len(doc.Content) == 0 {
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return errors.New("the configuration file is not a YAML mapping")
+	}
+
+	m := root
+	for _, key := range section {
+		m = yamlMapping(m, key)
+	}
+	for _, item := range values {
+		var v yaml.Node
+		if err := v.Encode(item.Value); err != nil {
+			return errors.Wrap(err, "cannot encode configuration")
+		}
+		yamlSet(m, item.Key, &v)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return errors.Wrap(err, "cannot encode configuration")
+	}
+	enc.Close()
+	out := buf.Bytes()
+
+	// Keep the document markers if there were some
+	if bytes.HasPrefix(data, []byte("---")) && !bytes.HasPrefix(out, []byte("---")) {
+		out = append([]byte("---\n"), out...)
+	}
+	if bytes.HasSuffix(bytes.TrimSpace(data), []byte("\n...")) {
+		out = append(out, "...\n"...)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.Wrap(err, "cannot create configuration directory")
+	}
+	if err := ioutil.WriteFile(path, out, mode); err != nil {
+		return errors.Wrap(err, "cannot write configuration file")
+	}
+	return nil
+}
+
+// yamlLookup returns the index of the key node in a YAML mapping, or -1
+// Keys are compared case-insensitively, as Viper does.
+func yamlLookup(m *yaml.Node, key string) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if strings.EqualFold(m.Content[i].Value, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// yamlMapping returns the mapping value of a key of a YAML mapping
+// The key is created if necessary; an empty value is replaced with a new
+// mapping.
+func yamlMapping(m *yaml.Node, key string) *yaml.Node {
+	if i := yamlLookup(m, key); i >= 0 {
+		v := m.Content[i+1]
+		if v.Kind != yaml.MappingNode {
+			v.Kind, v.Tag, v.Value, v.Style = yaml.MappingNode, "!!map", "", 0
+			v.Content = nil
+		}
+		return v
+	}
+	v := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, v)
+	return v
+}
+
+// yamlSet sets the value of a key of a YAML mapping
+// The comments of an existing value are kept.
+func yamlSet(m *yaml.Node, key string, value *yaml.Node) {
+	if i := yamlLookup(m, key); i >= 0 {
+		old := m.Content[i+1]
+		value.HeadComment, value.LineComment, value.FootComment =
+			old.HeadComment, old.LineComment, old.FootComment
+		m.Content[i+1] = value
+		return
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
@@ -0,0 +1,387 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/McKael/samtv"
+)
+
+// exportPrefix is the prefix of the exported credentials string
+const exportPrefix = "samtv:"
+
+// tvProbeTimeout is the maximum delay to get the TV identifier
+const tvProbeTimeout = 3 * time.Second
+
+// exportPassphraseEnvVar is the environment variable that can be used to
+// provide the export passphrase non-interactively
+const exportPassphraseEnvVar = "SAMTVCLI_EXPORT_PASSPHRASE"
+
+// credentialsExport contains the exported pairing data
+type credentialsExport struct {
+	Server     string `json:"server"`
+	DUID       string `json:"duid,omitempty"`
+	DeviceUUID string `json:"device_uuid"`
+	SessionID  int    `json:"session_id"`
+	SessionKey string `json:"session_key"`
+	AppID      string `json:"app_id,omitempty"`
+	UserID     string `json:"user_id,omitempty"`
+	Token      string `json:"token,omitempty"`
+	Backend    string `json:"backend,omitempty"`
+}
+
+var credentialsExportFile *string
+var credentialsImportName *string
+var credentialsImportForce *bool
+
+// credentialsCmd represents the credentials command
+var credentialsCmd = &cobra.Command{
+	Use:   "credentials",
+	Short: "Export or import pairing credentials",
+	Long: `This command can be used to share pairing credentials between machines.
+
+The exported credentials are protected with a passphrase; they are
+encoded as a single line of text that can also be stored in a QR code.
+The passphrase can be provided with the ` + exportPassphraseEnvVar + `
+environment variable.`,
+}
+
+// credentialsExportCmd represents the credentials export command
+var credentialsExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export pairing credentials",
+	Long:  `Export the pairing credentials of the selected TV.`,
+	Example: `  samtvcli --tv living credentials export
+  samtvcli --tv living credentials export --output living.samtv`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := loadCredentials()
+		if err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+		if (c.SessionKey == "" || c.SessionID <= 0) && c.Token == "" {
+			logrus.Error("No credentials to export; please pair with the TV first")
+			os.Exit(1)
+		}
+
+		e := credentialsExport{
+			Server:     server,
+			DeviceUUID: c.DeviceUUID,
+			SessionID:  c.SessionID,
+			SessionKey: c.SessionKey,
+			AppID:      c.AppID,
+			UserID:     c.UserID,
+			Token:      c.Token,
+			Backend:    tvBackend,
+		}
+
+		// Record the TV identifier if it is reachable
+		if duid, err := tvDUID(tvBackend, server, tvPorts); err == nil {
+			e.DUID = duid
+		} else {
+			logrus.Info("Could not get the TV identifier: ", err)
+		}
+
+		passphrase, err := exportPassphrase(true)
+		if err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+		str, err := encodeCredentialsExport(e, passphrase)
+		if err != nil {
+			logrus.Error("Cannot export credentials: ", err)
+			os.Exit(1)
+		}
+
+		if *credentialsExportFile == "" {
+			fmt.Println(str)
+			return
+		}
+		if err := writePrivateFile(*credentialsExportFile, []byte(str+"\n")); err != nil {
+			logrus.Error("Cannot write export file: ", err)
+			os.Exit(1)
+		}
+		logrus.Infof("Credentials exported to '%s'", *credentialsExportFile)
+	},
+}
+
+// credentialsImportCmd represents the credentials import command
+var credentialsImportCmd = &cobra.Command{
+	Use:   "import FILE|STRING|-",
+	Short: "Import pairing credentials",
+	Long: `Import pairing credentials exported by another machine.
+
+The credentials are saved to the selected TV profile, or to the profile
+given with --name (it is created if needed).  The TV address is updated
+as well.
+
+If the TV identifier has been exported and the TV is reachable, the
+identifier is checked: the credentials are not imported if the TV at the
+exported address is another TV, unless --force is used.`,
+	Example: `  samtvcli credentials import --name living living.samtv
+  samtvcli --tv living credentials import samtv:U0FNVFYx...`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		str, err := readImportArg(args[0])
+		if err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+		passphrase, err := exportPassphrase(false)
+		if err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+		e, err := decodeCredentialsExport(str, passphrase)
+		if err != nil {
+			logrus.Error("Cannot import credentials: ", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("TV address:  %s\n", e.Server)
+		if e.DUID != "" {
+			fmt.Printf("TV DUID:     %s\n", e.DUID)
+		}
+		fmt.Printf("Device UUID: %s\n", e.DeviceUUID)
+		if e.Token != "" {
+			fmt.Printf("Backend:     %s\n", e.Backend)
+		} else {
+			fmt.Printf("Session ID:  %d\n", e.SessionID)
+		}
+
+		if err := checkImportDUID(e); err != nil {
+			if !*credentialsImportForce {
+				logrus.Error(err)
+				logrus.Info("Use --force to import the credentials anyway")
+				os.Exit(1)
+			}
+			logrus.Warn(err)
+		}
+
+		if err := importCredentials(e); err != nil {
+			logrus.Error("Cannot import credentials: ", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(credentialsCmd)
+	credentialsCmd.AddCommand(credentialsExportCmd)
+	credentialsCmd.AddCommand(credentialsImportCmd)
+
+	credentialsExportFile = credentialsExportCmd.Flags().StringP("output", "o", "", "Write the credentials to a file")
+	credentialsImportName = credentialsImportCmd.Flags().String("name", "", "TV profile name")
+	credentialsImportForce = credentialsImportCmd.Flags().Bool("force", false, "Import the credentials even if the TV identifier does not match")
+}
+
+// tvDUID returns the TV identifier from the device description
+// The TV is not waited for more than tvProbeTimeout.
+func tvDUID(backend, tvAddress string, ports samtv.Ports) (string, error) {
+	b, err := newBackend(backend, tvAddress, ports, samtv.Credentials{})
+	if err != nil {
+		return "", err
+	}
+
+	type result struct {
+		desc samtv.SmartDeviceDescription
+		err  error
+	}
+	res := make(chan result, 1)
+	go func() {
+		desc, err := b.DeviceDescription()
+		res <- result{desc, err}
+	}()
+
+	select {
+	case r := <-res:
+		if r.err != nil {
+			return "", r.err
+		}
+		if r.desc.DUID == "" {
+			return "", errors.New("no identifier in the device description")
+		}
+		return r.desc.DUID, nil
+	case <-time.After(tvProbeTimeout):
+		return "", errors.New("the TV did not answer")
+	}
+}
+
+// checkImportDUID checks the TV at the exported address is the exported TV
+// It only fails if the TV answers with another identifier.
+func checkImportDUID(e credentialsExport) error {
+	if e.DUID == "" {
+		return nil
+	}
+	duid, err := tvDUID(e.Backend, e.Server, tvPorts)
+	if err != nil {
+		logrus.Warn("Could not check the TV identifier: ", err)
+		return nil
+	}
+	if duid != e.DUID {
+		return errors.Errorf("the TV at %s is not the exported TV (identifier %s)", e.Server, duid)
+	}
+	logrus.Debug("The TV identifier matches")
+	return nil
+}
+
+// importCredentials saves the imported credentials and TV address
+func importCredentials(e credentialsExport) error {
+	name := *credentialsImportName
+	profile := currentTV
+	if name == "" {
+		name = tvName
+	} else if p, err := loadTVProfile(name); err == nil {
+		profile = p
+	} else {
+		profile = &tvProfile{} // New profile
+	}
+
+	var section []string
+	currentServer, currentBackend := server, tvBackend
+	if name != "" {
+		section = []string{"tvs", name}
+		currentServer, currentBackend = profile.Server, profileBackend(profile)
+	}
+
+	// Update the TV address and backend
+	var values []configItem
+	if e.Server != "" && e.Server != currentServer {
+		values = append(values, configItem{Key: "server", Value: e.Server})
+	}
+	if e.Backend != "" && e.Backend != currentBackend {
+		values = append(values, configItem{Key: "backend", Value: e.Backend})
+	}
+	if len(values) > 0 {
+		path, err := configFilePath()
+		if err != nil {
+			return err
+		}
+		if err := backupFile(path); err != nil {
+			return errors.Wrap(err, "cannot backup configuration file")
+		}
+		if err := updateConfigFile(path, section, values); err != nil {
+			return err
+		}
+	}
+
+	store, err := getCredentialStore(name, profile)
+	if err != nil {
+		return err
+	}
+	return store.Save(samtv.Credentials{
+		DeviceUUID: e.DeviceUUID,
+		SessionID:  e.SessionID,
+		SessionKey: e.SessionKey,
+		AppID:      e.AppID,
+		UserID:     e.UserID,
+		Token:      e.Token,
+	})
+}
+
+// exportPassphrase returns the passphrase used to protect the exported
+// credentials.  If confirm is true, the user has to type it twice.
+func exportPassphrase(confirm bool) (string, error) {
+	if p := os.Getenv(exportPassphraseEnvVar); p != "" {
+		return p, nil
+	}
+	p, err := readPassphrase("Export passphrase: ")
+	if err != nil || !confirm {
+		return p, err
+	}
+	p2, err := readPassphrase("Confirm passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if p != p2 {
+		return "", errors.New("the passphrases do not match")
+	}
+	return p, nil
+}
+
+// encodeCredentialsExport encrypts and encodes the credentials as a string
+func encodeCredentialsExport(e credentialsExport, passphrase string) (string, error) {
+	plain, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	data, err := encryptData(passphrase, plain)
+	if err != nil {
+		return "", err
+	}
+	return exportPrefix + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCredentialsExport decodes the string built by encodeCredentialsExport
+func decodeCredentialsExport(str, passphrase string) (credentialsExport, error) {
+	var e credentialsExport
+
+	str = strings.TrimSpace(str)
+	if !strings.HasPrefix(str, exportPrefix) {
+		return e, errors.New("not a samtv credentials string")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(str[len(exportPrefix):])
+	if err != nil {
+		return e, errors.Wrap(err, "cannot decode credentials string")
+	}
+	plain, err := decryptData(passphrase, data)
+	if err != nil {
+		return e, err
+	}
+	if err := json.Unmarshal(plain, &e); err != nil {
+		return e, errors.Wrap(err, "cannot parse credentials")
+	}
+	if (e.SessionKey == "" || e.SessionID <= 0) && e.Token == "" {
+		return e, errors.New("incomplete credentials")
+	}
+	return e, nil
+}
+
+// readImportArg returns the credentials string from the argument, which can
+// be the string itself, a file path or "-" for the standard input
+func readImportArg(arg string) (string, error) {
+	if strings.HasPrefix(arg, exportPrefix) {
+		return arg, nil
+	}
+	if arg == "-" {
+		line, err := stdinReader.ReadString('\n')
+		if err != nil && line == "" {
+			return "", errors.Wrap(err, "cannot read standard input")
+		}
+		return line, nil
+	}
+	data, err := ioutil.ReadFile(arg)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot read credentials file")
+	}
+	return string(data), nil
+}
@@ -0,0 +1,356 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+
+	"github.com/McKael/samtv"
+)
+
+// credentialStore is the interface implemented by the session credentials
+// storage backends
+type credentialStore interface {
+	Load() (samtv.Credentials, error)
+	Save(samtv.Credentials) error
+}
+
+// credentialStoreConfig contains the credentials storage settings
+// This is the "credentials" section of the configuration file or of a
+// TV profile.
+type credentialStoreConfig struct {
+	Store       string `mapstructure:"store"`        // config, file, command or encrypted
+	Path        string `mapstructure:"path"`         // file and encrypted stores
+	Command     string `mapstructure:"command"`      // command store
+	SaveCommand string `mapstructure:"save_command"` // command store
+}
+
+// credentialsData is the YAML representation of the session credentials
+type credentialsData struct {
+	DeviceUUID string `yaml:"device_uuid"`
+	SessionID  int    `yaml:"session_id"`
+	SessionKey string `yaml:"session_key"`
+	AppID      string `yaml:"app_id,omitempty"`
+	UserID     string `yaml:"user_id,omitempty"`
+	Token      string `yaml:"token,omitempty"`
+}
+
+func newCredentialsData(c samtv.Credentials) credentialsData {
+	return credentialsData{
+		DeviceUUID: c.DeviceUUID,
+		SessionID:  c.SessionID,
+		SessionKey: c.SessionKey,
+		AppID:      c.AppID,
+		UserID:     c.UserID,
+		Token:      c.Token,
+	}
+}
+
+func (d credentialsData) credentials() samtv.Credentials {
+	return samtv.Credentials{
+		DeviceUUID: d.DeviceUUID,
+		SessionID:  d.SessionID,
+		SessionKey: d.SessionKey,
+		AppID:      d.AppID,
+		UserID:     d.UserID,
+		Token:      d.Token,
+	}
+}
+
+// getCredentialStore returns the credentials store for a TV profile
+// If the profile is nil, the global settings are used.
+func getCredentialStore(name string, p *tvProfile) (credentialStore, error) {
+	var cfg credentialStoreConfig
+	configCreds := samtv.Credentials{
+		DeviceUUID: smartDeviceID,
+		SessionID:  smartSessionID,
+		SessionKey: smartSessionKey,
+		AppID:      viper.GetString("app_id"),
+		UserID:     viper.GetString("user_id"),
+		Token:      viper.GetString("token"),
+	}
+	var section []string
+
+	if p != nil {
+		cfg = p.Credentials
+		configCreds = samtv.Credentials{
+			DeviceUUID: p.DeviceUUID,
+			SessionID:  p.SessionID,
+			SessionKey: p.SessionKey,
+			AppID:      p.AppID,
+			UserID:     p.UserID,
+			Token:      p.Token,
+		}
+		section = []string{"tvs", name}
+	} else if err := viper.UnmarshalKey("credentials", &cfg); err != nil {
+		return nil, errors.Wrap(err, "cannot parse credentials settings")
+	}
+
+	path, err := homedir.Expand(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Store {
+	case "", "config":
+		return &configCredentialStore{section: section, creds: configCreds}, nil
+	case "file":
+		if path == "" {
+			return nil, errors.New("no path for the credentials file")
+		}
+		return &fileCredentialStore{path: path}, nil
+	case "command":
+		if cfg.Command == "" {
+			return nil, errors.New("no command for the credentials store")
+		}
+		return &commandCredentialStore{
+			command:     cfg.Command,
+			saveCommand: cfg.SaveCommand,
+			defaults:    configCreds,
+		}, nil
+	case "encrypted":
+		if path == "" {
+			return nil, errors.New("no path for the encrypted credentials file")
+		}
+		return &encryptedCredentialStore{path: path}, nil
+	}
+	return nil, errors.Errorf("unknown credentials store '%s'", cfg.Store)
+}
+
+// loadCredentials returns the session credentials for the selected TV
+// Credentials given on the command line take precedence over the store.
+func loadCredentials() (samtv.Credentials, error) {
+	store, err := getCredentialStore(tvName, currentTV)
+	if err != nil {
+		return samtv.Credentials{}, err
+	}
+	c, err := store.Load()
+	if err != nil {
+		return c, errors.Wrap(err, "cannot load credentials")
+	}
+
+	flags := RootCmd.PersistentFlags()
+	if flags.Changed("device-uuid") {
+		c.DeviceUUID = smartDeviceID
+	}
+	if flags.Changed("session-key") {
+		c.SessionKey = smartSessionKey
+	}
+	if flags.Changed("session-id") {
+		c.SessionID = smartSessionID
+	}
+	return c, nil
+}
+
+// saveCredentials saves the session credentials of the selected TV
+func saveCredentials(c samtv.Credentials) error {
+	store, err := getCredentialStore(tvName, currentTV)
+	if err != nil {
+		return err
+	}
+	return store.Save(c)
+}
+
+// configCredentialStore keeps the credentials in the configuration file
+// (session_key, session_id and device_uuid items)
+type configCredentialStore struct {
+	section []string
+	creds   samtv.Credentials
+}
+
+func (cs *configCredentialStore) Load() (samtv.Credentials, error) {
+	return cs.creds, nil
+}
+
+// Save writes the credentials to the configuration file
+// The previous configuration file is kept as a backup.
+func (cs *configCredentialStore) Save(c samtv.Credentials) error {
+	path, err := configFilePath()
+	if err != nil {
+		return err
+	}
+
+	if err := backupFile(path); err != nil {
+		return errors.Wrap(err, "cannot backup configuration file")
+	}
+
+	var values []configItem
+	if c.SessionKey != "" || c.Token == "" {
+		values = []configItem{
+			{Key: "device_uuid", Value: c.DeviceUUID},
+			{Key: "session_key", Value: c.SessionKey},
+			{Key: "session_id", Value: c.SessionID},
+		}
+	}
+	if c.AppID != "" {
+		values = append(values, configItem{Key: "app_id", Value: c.AppID})
+	}
+	if c.UserID != "" {
+		values = append(values, configItem{Key: "user_id", Value: c.UserID})
+	}
+	if c.Token != "" {
+		values = append(values, configItem{Key: "token", Value: c.Token})
+	}
+	if err := updateConfigFile(path, cs.section, values); err != nil {
+		return err
+	}
+
+	cs.creds = c
+	logrus.Infof("Credentials saved to '%s'", path)
+	return nil
+}
+
+// fileCredentialStore keeps the credentials in a separate YAML file,
+// only readable by the user
+type fileCredentialStore struct {
+	path string
+}
+
+func (fs *fileCredentialStore) Load() (samtv.Credentials, error) {
+	fi, err := os.Stat(fs.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return samtv.Credentials{}, nil // Not paired yet
+		}
+		return samtv.Credentials{}, err
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		logrus.Warnf("Credentials file '%s' is accessible by other users", fs.path)
+	}
+
+	data, err := ioutil.ReadFile(fs.path)
+	if err != nil {
+		return samtv.Credentials{}, err
+	}
+	var d credentialsData
+	if err := yaml.Unmarshal(data, &d); err != nil {
+		return samtv.Credentials{}, errors.Wrap(err, "cannot parse credentials file")
+	}
+	return d.credentials(), nil
+}
+
+func (fs *fileCredentialStore) Save(c samtv.Credentials) error {
+	data, err := yaml.Marshal(newCredentialsData(c))
+	if err != nil {
+		return err
+	}
+	if err := writePrivateFile(fs.path, data); err != nil {
+		return err
+	}
+	logrus.Infof("Credentials saved to '%s'", fs.path)
+	return nil
+}
+
+// commandCredentialStore gets the credentials from an external command,
+// e.g. a password manager.
+// The command output can be either the YAML credentials or the session key
+// on the first line; in the latter case the session ID and device UUID are
+// taken from the configuration file.
+// The save command, if any, receives the YAML credentials on its standard
+// input.
+type commandCredentialStore struct {
+	command     string
+	saveCommand string
+	defaults    samtv.Credentials
+}
+
+func (cs *commandCredentialStore) Load() (samtv.Credentials, error) {
+	logrus.Debugf("Running credentials command `%s`", cs.command)
+	c := exec.Command("sh", "-c", cs.command)
+	c.Stdin = os.Stdin
+	c.Stderr = os.Stderr
+	out, err := c.Output()
+	if err != nil {
+		return samtv.Credentials{}, errors.Wrap(err, "credentials command failed")
+	}
+
+	var d credentialsData
+	if err := yaml.Unmarshal(out, &d); err == nil && d.SessionKey != "" {
+		return d.credentials(), nil
+	}
+
+	// Plain output
+	creds := cs.defaults
+	creds.SessionKey = strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	return creds, nil
+}
+
+func (cs *commandCredentialStore) Save(c samtv.Credentials) error {
+	if cs.saveCommand == "" {
+		return errors.New("no save command for the credentials store")
+	}
+	data, err := yaml.Marshal(newCredentialsData(c))
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("Running credentials save command `%s`", cs.saveCommand)
+	cmd := exec.Command("sh", "-c", cs.saveCommand)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Wrap(err, "credentials save command failed")
+	}
+	logrus.Info("Credentials saved using the save command")
+	return nil
+}
+
+// writePrivateFile writes data to a file only readable by the user
+// The data is written to a temporary file, which replaces the target file,
+// so that the secret is never readable with the permissions of an
+// existing file.
+func writePrivateFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+
+	"github.com/McKael/samtv"
+)
+
+// Encrypted data format: magic string, salt, nonce and AES-GCM ciphertext
+const (
+	encryptedMagic      = "SAMTV1"
+	encryptionSaltSize  = 16
+	encryptionKeyRounds = 100000
+)
+
+// passphraseMaxAttempts is the number of passphrase prompts for a file
+const passphraseMaxAttempts = 3
+
+// passphraseEnvVar is the environment variable that can be used to provide
+// the passphrase non-interactively
+const passphraseEnvVar = "SAMTVCLI_PASSPHRASE"
+
+// passphrases caches the passphrases of the encrypted files, so that they
+// are not asked twice.  The last passphrase is tried first for the other
+// files, since the profiles often share the same passphrase.
+var passphrases = struct {
+	sync.Mutex
+	byPath map[string]string
+	last   string
+}{byPath: make(map[string]string)}
+
+// errWrongPassphrase is returned when the data cannot be decrypted
+var errWrongPassphrase = errors.New("decryption failed (wrong passphrase?)")
+
+// encryptedCredentialStore keeps the credentials in a file encrypted with
+// a passphrase
+type encryptedCredentialStore struct {
+	path string
+}
+
+func (es *encryptedCredentialStore) Load() (samtv.Credentials, error) {
+	data, err := ioutil.ReadFile(es.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return samtv.Credentials{}, nil // Not paired yet
+		}
+		return samtv.Credentials{}, err
+	}
+
+	var plain []byte
+	prompt, prompts := false, 0
+	for {
+		passphrase, fromUser, err := getPassphrase(es.path, prompt)
+		if err != nil {
+			return samtv.Credentials{}, err
+		}
+		if fromUser {
+			prompts++
+		}
+		plain, err = decryptData(passphrase, data)
+		if err == nil {
+			setPassphrase(es.path, passphrase)
+			break
+		}
+		// Ask the user (again) if the passphrase was wrong, unless it
+		// comes from the environment
+		if err != errWrongPassphrase || prompts >= passphraseMaxAttempts ||
+			(!fromUser && os.Getenv(passphraseEnvVar) != "") {
+			return samtv.Credentials{}, err
+		}
+		if fromUser {
+			logrus.Warn(err)
+		}
+		prompt = true
+	}
+
+	var d credentialsData
+	if err := yaml.Unmarshal(plain, &d); err != nil {
+		return samtv.Credentials{}, errors.Wrap(err, "cannot parse credentials")
+	}
+	return d.credentials(), nil
+}
+
+func (es *encryptedCredentialStore) Save(c samtv.Credentials) error {
+	plain, err := yaml.Marshal(newCredentialsData(c))
+	if err != nil {
+		return err
+	}
+	passphrase, _, err := getPassphrase(es.path, false)
+	if err != nil {
+		return err
+	}
+	setPassphrase(es.path, passphrase)
+	data, err := encryptData(passphrase, plain)
+	if err != nil {
+		return err
+	}
+	if err := writePrivateFile(es.path, data); err != nil {
+		return err
+	}
+	logrus.Infof("Credentials saved to encrypted file '%s'", es.path)
+	return nil
+}
+
+// getPassphrase returns the passphrase of an encrypted file, from the
+// cache or the environment, or asks the user for it.  If prompt is true,
+// the user is always asked.  fromUser is true if the passphrase has been
+// typed by the user.
+func getPassphrase(path string, prompt bool) (passphrase string, fromUser bool, err error) {
+	passphrases.Lock()
+	defer passphrases.Unlock()
+
+	if !prompt {
+		if p := passphrases.byPath[path]; p != "" {
+			return p, false, nil
+		}
+		if p := os.Getenv(passphraseEnvVar); p != "" {
+			return p, false, nil
+		}
+		if passphrases.last != "" {
+			return passphrases.last, false, nil
+		}
+	}
+
+	p, err := readPassphrase(fmt.Sprintf("Passphrase for '%s': ", path))
+	if err != nil {
+		return "", false, err
+	}
+	passphrases.last = p
+	return p, true, nil
+}
+
+// setPassphrase records the passphrase of an encrypted file
+func setPassphrase(path, passphrase string) {
+	passphrases.Lock()
+	passphrases.byPath[path] = passphrase
+	passphrases.last = passphrase
+	passphrases.Unlock()
+}
+
+// readPassphrase asks the user for a passphrase
+// The passphrase is not echoed if the input is a terminal.
+func readPassphrase(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+
+	var line string
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		line = string(b)
+	} else {
+		var err error
+		line, err = stdinReader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+	}
+	p := strings.TrimRight(line, "\r\n")
+	if p == "" {
+		return "", errors.New("empty passphrase")
+	}
+	return p, nil
+}
+
+// encryptData encrypts data with a key derived from the passphrase
+func encryptData(passphrase string, plain []byte) ([]byte, error) {
+	salt := make([]byte, encryptionSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := newPassphraseCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.WriteString(encryptedMagic)
+	b.Write(salt)
+	b.Write(nonce)
+	b.Write(gcm.Seal(nil, nonce, plain, []byte(encryptedMagic)))
+	return b.Bytes(), nil
+}
+
+// decryptData decrypts data encrypted by encryptData
+func decryptData(passphrase string, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(encryptedMagic)) {
+		return nil, errors.New("unknown encrypted data format")
+	}
+	data = data[len(encryptedMagic):]
+	if len(data) < encryptionSaltSize {
+		return nil, errors.New("encrypted data is too short")
+	}
+	salt, data := data[:encryptionSaltSize], data[encryptionSaltSize:]
+
+	gcm, err := newPassphraseCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted data is too short")
+	}
+	nonce, data := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+
+	plain, err := gcm.Open(nil, nonce, data, []byte(encryptedMagic))
+	if err != nil {
+		return nil, errWrongPassphrase
+	}
+	return plain, nil
+}
+
+func newPassphraseCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key := pbkdf2.Key([]byte(passphrase), salt, encryptionKeyRounds, 32, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
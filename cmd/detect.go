@@ -0,0 +1,133 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/McKael/samtv"
+)
+
+var detectSave *bool
+
+// detectCmd represents the detect command
+var detectCmd = &cobra.Command{
+	Use:   "detect",
+	Short: "Detect the TV remote control protocol",
+	Long: `Probe the TV services and select the remote control backend.
+
+The device descriptions (SmartView and Tizen) are requested and the legacy
+remote control port is checked; the model year is deduced from the model
+name.  Use --debug to see why a backend has been selected.
+
+With the --save flag, the backend and the model year are recorded in the
+configuration file.  When a TV profile is selected, they are always
+recorded in the profile.  The detection is also done by the pair command
+when no backend is configured.`,
+	Example: `  samtvcli detect
+  samtvcli --tv bedroom detect
+  samtvcli --server 192.168.1.52 --debug detect --save`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		d, err := detectBackend()
+		if err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Backend:", d.Backend)
+		if d.Description != nil {
+			fmt.Println("Model:  ", d.Description.ModelName)
+		}
+		if d.Year > 0 {
+			fmt.Println("Year:   ", d.Year)
+		}
+
+		if *detectSave || tvName != "" {
+			if err := saveDetection(d); err != nil {
+				logrus.Error("Could not save backend: ", err)
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(detectCmd)
+
+	detectSave = detectCmd.Flags().Bool("save", false, "Save the backend to the configuration file")
+}
+
+// detectBackend probes the selected TV and explains the choice in the
+// debug output
+func detectBackend() (*samtv.Detection, error) {
+	if server == "" {
+		return nil, errors.New("no TV address")
+	}
+	logrus.Infof("Detecting the protocol of %s...", server)
+	d, err := samtv.DetectBackend(server, tvPorts)
+	if d != nil {
+		for _, r := range d.Reasons {
+			logrus.Debug("Detection: ", r)
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot detect the TV protocol")
+	}
+	return d, nil
+}
+
+// saveDetection records the backend and the model year in the selected TV
+// profile, or in the global section of the configuration file
+func saveDetection(d *samtv.Detection) error {
+	path, err := configFilePath()
+	if err != nil {
+		return err
+	}
+	if err := backupFile(path); err != nil {
+		return errors.Wrap(err, "cannot backup configuration file")
+	}
+
+	var section []string
+	if tvName != "" {
+		section = []string{"tvs", tvName}
+	}
+	items := []configItem{{Key: "backend", Value: d.Backend}}
+	if d.Year > 0 {
+		items = append(items, configItem{Key: "model_year", Value: d.Year})
+	}
+	if err := updateConfigFile(path, section, items); err != nil {
+		return err
+	}
+	if currentTV != nil {
+		currentTV.Backend = d.Backend
+		if d.Year > 0 {
+			currentTV.ModelYear = d.Year
+		}
+	}
+	logrus.Infof("Detection results saved to '%s'", path)
+	return nil
+}
@@ -37,7 +37,7 @@ var deviceDescriptionCmd = &cobra.Command{
 	Short: "Get device description",
 	Long:  `Retrieve the device description from TV.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		s, err := samtv.NewSmartViewSession(server)
+		s, err := newBackend(tvBackend, server, tvPorts, samtv.Credentials{})
 		if err != nil {
 			logrus.Error(err)
 			os.Exit(1)
@@ -0,0 +1,217 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/McKael/samtv"
+	"github.com/McKael/samtv/samtvtest"
+)
+
+var emulateAddress, emulatePIN *string
+var emulatePorts samtv.Ports
+
+// emulateCmd represents the emulate command
+var emulateCmd = &cobra.Command{
+	Use:   "emulate",
+	Short: "Run a virtual TV",
+	Long: `Run a virtual Samsung TV that can be used without hardware.
+
+The virtual TV serves the device description, pairing and SmartView
+remote control services.  It keeps a simple state (power, volume, mute,
+channel, source and menu) that is updated by the received keys and
+displayed in the terminal.  The PIN code is displayed when a client
+requests the pairing PIN page.
+
+Clients should use the same ports; they can be set with the "ports"
+item of the configuration file or of the TV profile.`,
+	Example: `  samtvcli emulate
+  samtvcli emulate --pin 1234 --socketio-port 18000 --description-port 18001 --pairing-port 18080
+  samtvcli --server 127.0.0.1 pair --interactive --save`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		srv, err := samtvtest.NewServer(samtvtest.Config{
+			Address: *emulateAddress,
+			Ports:   emulatePorts,
+			PIN:     *emulatePIN,
+		})
+		if err != nil {
+			logrus.Error("Cannot start the virtual TV: ", err)
+			os.Exit(1)
+		}
+		defer srv.Close()
+
+		e := &emulator{
+			srv:    srv,
+			state:  samtvtest.NewState(),
+			render: isTerminal(os.Stdout),
+			out:    os.Stdout,
+		}
+		srv.SetKeyHandler(e.key)
+		srv.SetPINPageHandler(e.pinPage)
+		e.display("Virtual TV started")
+
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+		<-sigCh
+		fmt.Fprintln(os.Stderr)
+		logrus.Info("Stopping the virtual TV")
+	},
+}
+
+// emulator displays the state of the virtual TV
+type emulator struct {
+	srv    *samtvtest.Server
+	render bool // Redraw the screen on each event
+	out    io.Writer
+
+	mux     sync.Mutex
+	state   samtvtest.State
+	pin     string
+	lastKey string
+	keys    int
+}
+
+func (e *emulator) key(key string) {
+	e.mux.Lock()
+	e.keys++
+	e.lastKey = key
+	changed := e.state.Apply(key)
+	e.mux.Unlock()
+
+	if changed {
+		e.display("Key " + key)
+	} else {
+		e.display("Key " + key + " (ignored)")
+	}
+}
+
+func (e *emulator) pinPage(pin string, running bool) {
+	e.mux.Lock()
+	if running {
+		e.pin = pin
+	} else {
+		e.pin = ""
+	}
+	e.mux.Unlock()
+
+	if running {
+		e.display("PIN page opened, PIN code: " + pin)
+	} else {
+		e.display("PIN page closed")
+	}
+}
+
+// display prints the event, or redraws the screen with the TV state
+func (e *emulator) display(event string) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	st := e.state
+	if !e.render {
+		fmt.Fprintf(e.out, "%s -- %s\n", event, e.stateSummary())
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("\033[H\033[2J") // Clear screen
+	ports := e.srv.Ports()
+	fmt.Fprintf(&b, "Virtual Samsung TV on %s\n", e.srv.Address())
+	fmt.Fprintf(&b, "Ports: socket.io %d, description %d, pairing %d\n\n",
+		ports.SocketIO, ports.Description, ports.Pairing)
+	fmt.Fprintf(&b, "  Power:    %s\n", onOff(st.Power))
+	if st.Power {
+		vol := fmt.Sprintf("%d", st.Volume)
+		if st.Mute {
+			vol += " (muted)"
+		}
+		fmt.Fprintf(&b, "  Volume:   %-3s %s\n", vol,
+			strings.Repeat("#", st.Volume*30/samtvtest.MaxVolume))
+		fmt.Fprintf(&b, "  Channel:  %s", st.Channel)
+		if st.Input != "" {
+			fmt.Fprintf(&b, "  [%s_]", st.Input)
+		}
+		fmt.Fprintf(&b, "\n  Source:   %s\n", st.Source)
+		menu := "closed"
+		if st.Menu {
+			menu = "open"
+		}
+		fmt.Fprintf(&b, "  Menu:     %s\n", menu)
+	}
+	b.WriteString("\n")
+	if e.pin != "" {
+		fmt.Fprintf(&b, "  PIN code: %s\n", e.pin)
+	}
+	fmt.Fprintf(&b, "  Keys received: %d", e.keys)
+	if e.lastKey != "" {
+		fmt.Fprintf(&b, " (last: %s)", e.lastKey)
+	}
+	fmt.Fprintf(&b, "\n\n%s\n\nPress Ctrl-C to quit.\n", event)
+	io.WriteString(e.out, b.String())
+}
+
+// stateSummary returns the TV state on a single line
+func (e *emulator) stateSummary() string {
+	st := e.state
+	if !st.Power {
+		return "power off"
+	}
+	mute := ""
+	if st.Mute {
+		mute = " (muted)"
+	}
+	input := ""
+	if st.Input != "" {
+		input = " [" + st.Input + "_]"
+	}
+	return fmt.Sprintf("volume %d%s, channel %s%s, source %s, menu %s",
+		st.Volume, mute, st.Channel, input, st.Source, onOff(st.Menu))
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func init() {
+	RootCmd.AddCommand(emulateCmd)
+
+	emulateAddress = emulateCmd.Flags().String("listen", "127.0.0.1", "Listening IP address")
+	emulatePIN = emulateCmd.Flags().String("pin", "", "Pairing PIN code (random if empty)")
+	emulateCmd.Flags().IntVar(&emulatePorts.SocketIO, "socketio-port",
+		samtv.DefaultPorts.SocketIO, "SmartView socket.io service port")
+	emulateCmd.Flags().IntVar(&emulatePorts.Description, "description-port",
+		samtv.DefaultPorts.Description, "Device description service port")
+	emulateCmd.Flags().IntVar(&emulatePorts.Pairing, "pairing-port",
+		samtv.DefaultPorts.Pairing, "Pairing service port")
+}
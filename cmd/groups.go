@@ -0,0 +1,159 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/McKael/samtv"
+)
+
+// defaultGroupConcurrency is the default number of TV sessions opened
+// simultaneously for a group
+const defaultGroupConcurrency = 4
+
+var groupName string
+var groupConcurrency int
+
+// addGroupFlags adds the TV group flags to a command
+func addGroupFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&groupName, "group", "", "Send to a group of TVs")
+	cmd.Flags().IntVar(&groupConcurrency, "parallel", 0,
+		"Maximum number of TVs contacted simultaneously")
+	cmd.RegisterFlagCompletionFunc("group", completeGroupNames)
+}
+
+// getGroupMembers returns the TV profile names of a group
+// Groups are defined in the "groups" section of the configuration file.
+func getGroupMembers(name string) ([]string, error) {
+	key := "groups." + strings.ToLower(name)
+	if !viper.IsSet(key) {
+		return nil, errors.Errorf("unknown TV group '%s'", name)
+	}
+	members := viper.GetStringSlice(key)
+	if len(members) == 0 {
+		return nil, errors.Errorf("TV group '%s' is empty", name)
+	}
+	return members, nil
+}
+
+// runOnGroup opens a session with every TV of a group and runs the
+// action function on each of them.  The sessions are handled in parallel,
+// with a bounded concurrency.
+// A summary is displayed and an error is returned if any TV failed.
+func runOnGroup(name string, action func(samtv.Backend) error) error {
+	members, err := getGroupMembers(name)
+	if err != nil {
+		return err
+	}
+	profiles, err := getTVProfiles()
+	if err != nil {
+		return err
+	}
+
+	concurrency := groupConcurrency
+	if concurrency <= 0 {
+		concurrency = viper.GetInt("group_concurrency")
+	}
+	if concurrency <= 0 {
+		concurrency = defaultGroupConcurrency
+	}
+
+	results := make([]error, len(members))
+
+	// The credentials are loaded first, one profile at a time, since the
+	// credential stores can prompt for a passphrase or run commands.
+	creds := make([]samtv.Credentials, len(members))
+	for i, tv := range members {
+		p, ok := profiles[strings.ToLower(tv)]
+		if !ok {
+			results[i] = errors.New("unknown TV profile")
+			continue
+		}
+		creds[i], results[i] = loadProfileCredentials(tv, &p)
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, tv := range members {
+		if results[i] != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, tv string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			p := profiles[strings.ToLower(tv)]
+			logrus.Debugf("Opening session with '%s'", tv)
+			s, err := initProfileSession(tv, &p, creds[i])
+			if err != nil {
+				if s != nil {
+					s.Close()
+				}
+				results[i] = errors.Wrap(err, "cannot initialize session")
+				return
+			}
+			results[i] = action(s)
+			s.Close()
+		}(i, tv)
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, tv := range members {
+		if results[i] != nil {
+			failed++
+			fmt.Printf("%s: FAILED (%v)\n", tv, results[i])
+			continue
+		}
+		fmt.Printf("%s: OK\n", tv)
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d TV(s) failed", failed, len(members))
+	}
+	return nil
+}
+
+// completeGroupNames provides shell completion for the --group flag
+func completeGroupNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	loadCompletionConfig()
+
+	var names []string
+	for name := range viper.GetStringMap("groups") {
+		if strings.HasPrefix(name, strings.ToLower(toComplete)) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
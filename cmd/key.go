@@ -23,8 +23,10 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
@@ -32,8 +34,7 @@ import (
 )
 
 var keyList *bool
-
-//var keyHold, keyRelease *bool
+var keyHold *time.Duration
 
 // keyCmd represents the key command
 var keyCmd = &cobra.Command{
@@ -44,14 +45,27 @@ var keyCmd = &cobra.Command{
 The available key identifiers can be displayed using the --list option.
 
 When several keys are given, a small delay is inserted between the
-keys.  If a bigger pause is required, the special argument '_' can be used.`,
+keys.  If a bigger pause is required, the special argument '_' can be used.
+
+With the --hold flag, each key is kept pressed for the given duration
+(e.g. to reach the service menus).  This requires a backend supporting
+separate key press and release events (tizen).
+
+Macros (named key sequences) can be defined in the "macros" section of
+the configuration file or of the TV profile, and used as arguments.
+
+If the TV rejects the stored credentials (e.g. after a factory reset),
+a new pairing is offered when running in a terminal.`,
 	Example: `  samtvcli key --list
   samtvcli key KEY_VOLDOWN
   samtvcli key KEY_MENU
   samtvcli key KEY_DOWN
   samtvcli key KEY_RETURN
   samtvcli key KEY_POWEROFF
-  samtvcli key KEY_MENU _ _ KEY_DOWN KEY_DOWN _ KEY_UP _ KEY_UP _ KEY_RETURN`,
+  samtvcli key KEY_MENU _ _ KEY_DOWN KEY_DOWN _ KEY_UP _ KEY_UP _ KEY_RETURN
+  samtvcli key netflix
+  samtvcli key --hold 3s KEY_POWER
+  samtvcli key --group showroom KEY_POWEROFF`,
 	Args: func(cmd *cobra.Command, args []string) error {
 		if !*keyList && len(args) < 1 {
 			return fmt.Errorf("requires at least 1 arg or --list")
@@ -66,35 +80,112 @@ keys.  If a bigger pause is required, the special argument '_' can be used.`,
 			return
 		}
 
-		samtvSession, err := initSession()
-		if err != nil {
-			logrus.Error("Cannot initialize session: ", err)
-			os.Exit(1)
+		send := sendKeys
+		if *keyHold > 0 {
+			send = func(s samtv.Backend, keys []string) error {
+				return holdKeys(s, keys, *keyHold)
+			}
 		}
 
-		for i, k := range args {
-			// Special argument '_' is a pause
-			if k == "_" {
-				time.Sleep(400 * time.Millisecond)
-				continue
-			}
-			if err := samtvSession.Key(k); err != nil {
-				logrus.Errorf("Cannot send key '%s': %v", k, err)
+		if groupName != "" {
+			// Send the same sequence to all the TVs of the group
+			keys := expandMacros(args, nil)
+			err := runOnGroup(groupName, func(s samtv.Backend) error {
+				return send(s, keys)
+			})
+			if err != nil {
+				logrus.Error(err)
 				os.Exit(1)
 			}
-			// Add a small pause between several keys
-			if i+1 < len(args) {
-				time.Sleep(100 * time.Millisecond)
-			}
+			return
+		}
+
+		keys := expandMacros(args, currentTV)
+
+		err := runWithSession(func(s samtv.Backend) error {
+			return send(s, keys)
+		})
+		if err != nil {
+			logrus.Error(err)
+			os.Exit(1)
 		}
-		samtvSession.Close()
 	},
 }
 
+// sendKeys sends a sequence of keys to the TV
+func sendKeys(samtvSession samtv.Backend, keys []string) error {
+	for i, k := range keys {
+		// Special argument '_' is a pause
+		if k == "_" {
+			time.Sleep(400 * time.Millisecond)
+			continue
+		}
+		if err := samtvSession.Key(k); err != nil {
+			return errors.Wrapf(err, "cannot send key '%s'", k)
+		}
+		// Add a small pause between several keys
+		if i+1 < len(keys) {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	return nil
+}
+
+// holdKeys sends a sequence of long key presses to the TV
+func holdKeys(samtvSession samtv.Backend, keys []string, d time.Duration) error {
+	for i, k := range keys {
+		if k == "_" {
+			time.Sleep(400 * time.Millisecond)
+			continue
+		}
+		if err := holdKey(samtvSession, k, d); err != nil {
+			return errors.Wrapf(err, "cannot send key '%s'", k)
+		}
+		if i+1 < len(keys) {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	return nil
+}
+
+// holdKey keeps a key pressed for the given duration
+func holdKey(samtvSession samtv.Backend, key string, d time.Duration) error {
+	kp, ok := samtvSession.(samtv.KeyPresser)
+	if !ok {
+		return errors.Errorf("long key presses are not supported by the %s backend",
+			samtvSession.Name())
+	}
+	if err := kp.Press(key); err != nil {
+		return err
+	}
+	time.Sleep(d)
+	return kp.Release(key)
+}
+
+// expandMacros replaces the macro names in the argument list with the
+// corresponding key sequences
+func expandMacros(args []string, p *tvProfile) []string {
+	macros := getMacros(p)
+	if len(macros) == 0 {
+		return args
+	}
+
+	var keys []string
+	for _, a := range args {
+		if m, ok := macros[strings.ToLower(a)]; ok && !strings.HasPrefix(a, "KEY_") {
+			logrus.Debugf("Expanding macro '%s': %v", a, m)
+			keys = append(keys, m...)
+			continue
+		}
+		keys = append(keys, a)
+	}
+	return keys
+}
+
 func init() {
 	RootCmd.AddCommand(keyCmd)
 
 	keyList = keyCmd.Flags().BoolP("list", "l", false, "List keys")
-	//keyHold = keyCmd.Flags().Bool("hold", false, "Hold key pressed")
-	//keyRelease = keyCmd.Flags().Bool("release", false, "Release previously-hold key")
+	addGroupFlags(keyCmd)
+	keyHold = keyCmd.Flags().Duration("hold", 0, "Hold the keys pressed for the given duration")
 }
@@ -0,0 +1,99 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/McKael/samtv"
+)
+
+var nowPlayingJSON *bool
+
+// nowPlayingCmd represents the now-playing command
+var nowPlayingCmd = &cobra.Command{
+	Use:   "now-playing",
+	Short: "Display the current channel and program",
+	Long: `Display the current source, channel and program title.
+
+This command uses the MainTVAgent2 service of the H/J models.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		a, err := samtv.NewMainTVAgent(server, tvPorts)
+		if err != nil {
+			logrus.Error("Cannot find the TV agent service: ", err)
+			os.Exit(1)
+		}
+		np, err := a.NowPlaying()
+		if err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+
+		if *nowPlayingJSON {
+			b, _ := json.MarshalIndent(np, "", "  ")
+			fmt.Printf("%s\n", b)
+			return
+		}
+		fmt.Println("Source: ", np.Source)
+		if np.Channel != nil {
+			fmt.Println("Channel:", channelLabel(np.Channel))
+		}
+		if np.Program != nil {
+			fmt.Println("Program:", np.Program.Title)
+			if np.Program.StartTime != "" {
+				fmt.Println("Start:  ", np.Program.StartTime)
+			}
+			if np.Program.EndTime != "" {
+				fmt.Println("End:    ", np.Program.EndTime)
+			}
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(nowPlayingCmd)
+
+	nowPlayingJSON = nowPlayingCmd.Flags().Bool("json", false, "Use JSON output")
+}
+
+// channelLabel returns the channel number and name
+func channelLabel(ch *samtv.TVChannel) string {
+	return strings.TrimSpace(ch.Number() + " " + ch.Name)
+}
+
+// nowPlayingStatus returns a short description of the current state
+func nowPlayingStatus(np samtv.NowPlaying) string {
+	if np.Channel == nil {
+		return np.Source
+	}
+	s := channelLabel(np.Channel)
+	if np.Program != nil {
+		s += ": " + np.Program.Title
+	}
+	return s
+}
@@ -22,51 +22,339 @@ package cmd
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
 	"github.com/McKael/samtv"
 )
 
 var pairingPIN *int
+var pairInteractive, pairSave, pairRandomUUID *bool
 
 // pairCmd represents the events command
 var pairCmd = &cobra.Command{
 	Use:   "pair",
 	Short: "Pair with a Smart TV",
-	Long:  `This command can be used to manage pairing with a Samsung TV.`,
+	Long: `This command can be used to manage pairing with a Samsung TV.
+
+With the --interactive flag, the PIN page is opened and the PIN code is
+requested on the terminal.
+
+With the --save flag, the credentials are saved and verified.  By default
+they are written to the configuration file (a backup copy is kept with
+the .bak extension), but another credentials store can be configured.
+When a TV profile is selected, the credentials are always saved.
+
+The pairing identity (device_uuid, app_id and user_id items) can be set
+in the configuration file or in the TV profile.  With the --random-uuid
+flag (or the random_device_uuid item), a random device UUID is generated
+if none is configured; it is saved with the credentials.
+
+With the tizen backend, there is no PIN code: the connection has to be
+allowed on the TV screen, and the access token sent by the TV is saved.
+The legacy backend works the same way, but the TV remembers the client
+identifier (device_uuid) instead of sending a token.
+
+If no backend is configured, the TV protocol is detected first (see the
+detect command) and the backend is saved with the credentials.`,
 	Example: `  samtvcli pair              # Start pairing process
   samtvcli pair --pin 1234   # Enter TV PIN code
-  samtvcli pair --pin -1     # A negative value closes the PIN page`,
+  samtvcli pair --pin -1     # A negative value closes the PIN page
+  samtvcli pair --interactive --save
+  samtvcli pair status       # Display the PIN page state
+  samtvcli pair verify       # Check the stored credentials`,
 	Run: func(cmd *cobra.Command, args []string) {
-		s, err := samtv.NewSmartViewSession(server)
+		// Get pairing identity
+		id, err := loadCredentials()
 		if err != nil {
 			logrus.Error(err)
 			os.Exit(1)
 		}
+		newPairing := *pairingPIN == 0 || *pairInteractive
+		if id.DeviceUUID == "" && randomDeviceUUIDEnabled() {
+			if newPairing {
+				if id.DeviceUUID, err = samtv.GenerateDeviceUUID(); err != nil {
+					logrus.Error(err)
+					os.Exit(1)
+				}
+				logrus.Info("Generated device UUID: ", id.DeviceUUID)
+			} else if *pairingPIN > 0 {
+				// The UUID of the pairing request must be used
+				if id.DeviceUUID, err = loadPendingDeviceUUID(); err != nil {
+					logrus.Error("No device UUID from the pairing request, please start again: ", err)
+					os.Exit(1)
+				}
+				logrus.Debug("Using the device UUID of the pairing request: ", id.DeviceUUID)
+			}
+			if !*pairInteractive && *pairingPIN == 0 {
+				// The same UUID must be used for the next step; the
+				// credential store is only updated once pairing succeeds.
+				if err := savePendingDeviceUUID(id.DeviceUUID); err != nil {
+					logrus.Warn("Could not keep the device UUID: ", err)
+					logrus.Info("Please use this UUID with --device-uuid when sending the PIN code")
+				}
+			}
+		}
 
-		// Set UUID
-		s.RestoreSessionData(nil, 0, smartDeviceID)
+		// Detect the protocol of a new TV
+		if tvBackend == "" && newPairing {
+			if d, err := detectBackend(); err != nil {
+				logrus.Warn(err)
+			} else {
+				tvBackend = d.Backend
+				logrus.Infof("Detected the %s backend", d.Backend)
+				if *pairSave || tvName != "" {
+					if err := saveDetection(d); err != nil {
+						logrus.Error("Could not save backend: ", err)
+					}
+				}
+			}
+		}
 
-		uuid, sid, key, err := s.Pair(*pairingPIN)
+		b, err := newBackend(tvBackend, server, tvPorts, pairingIdentity(id))
+		if err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+
+		// The SmartView pairing can be done in two steps
+		if r, ok := b.(samtv.Remote); ok && !*pairInteractive {
+			var key string
+			_, _, key, err = r.Pair(*pairingPIN)
+			if err == nil && *pairingPIN < 0 {
+				logrus.Info("PIN page closed")
+			}
+			if err == nil && key == "" {
+				return // No credentials yet
+			}
+		} else {
+			_, err = interactivePairing(b)
+		}
+		if err == errPairingInterrupted {
+			b.Close()
+			os.Exit(130)
+		}
 		if err != nil {
 			logrus.Error("Pairing error: ", err)
 			os.Exit(1)
 		}
 
-		if *pairingPIN > 0 && key != "" {
-			fmt.Fprintf(os.Stderr, "You can save the following items:\n")
-			fmt.Println("device_uuid: ", uuid)
-			fmt.Println("session_key: ", key)
-			fmt.Println("session_id:  ", sid)
+		removePendingDeviceUUID()
+
+		c := b.Credentials()
+		if *pairSave || tvName != "" {
+			if err := saveCredentials(c); err != nil {
+				logrus.Error("Could not save credentials: ", err)
+			} else {
+				err := verifyCredentials(c)
+				if err == errCannotVerify {
+					logrus.Info("The new credentials have been saved")
+					return
+				}
+				if err != nil {
+					logrus.Error("Could not verify the new credentials: ", err)
+					os.Exit(1)
+				}
+				logrus.Info("The new credentials have been verified")
+				return
+			}
+		}
+
+		fmt.Fprintf(os.Stderr, "You can save the following items:\n")
+		if c.Token != "" {
+			fmt.Println("token:       ", c.Token)
+			return
+		}
+		if c.SessionKey == "" {
+			// The TV only remembers the client identifier
+			fmt.Println("device_uuid: ", c.DeviceUUID)
+			fmt.Println("app_id:      ", c.AppID)
+			return
+		}
+		fmt.Println("device_uuid: ", c.DeviceUUID)
+		fmt.Println("session_key: ", c.SessionKey)
+		fmt.Println("session_id:  ", c.SessionID)
+		if id.AppID != "" || id.UserID != "" {
+			fmt.Println("app_id:      ", c.AppID)
+			fmt.Println("user_id:     ", c.UserID)
 		}
 	},
 }
 
+// randomDeviceUUIDEnabled returns true if a random device UUID should be
+// generated for pairing
+func randomDeviceUUIDEnabled() bool {
+	if *pairRandomUUID {
+		return true
+	}
+	if currentTV != nil {
+		return currentTV.RandomDeviceUUID
+	}
+	return viper.GetBool("random_device_uuid")
+}
+
+// pendingDeviceUUIDPath returns the path of the file keeping a generated
+// device UUID between the pairing steps
+func pendingDeviceUUIDPath() (string, error) {
+	return profileCachePath("pairing", ".uuid")
+}
+
+// savePendingDeviceUUID keeps the generated device UUID for the PIN step
+func savePendingDeviceUUID(uuid string) error {
+	path, err := pendingDeviceUUIDPath()
+	if err != nil {
+		return err
+	}
+	return writePrivateFile(path, []byte(uuid+"\n"))
+}
+
+// loadPendingDeviceUUID returns the device UUID of the pairing request
+func loadPendingDeviceUUID() (string, error) {
+	path, err := pendingDeviceUUIDPath()
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	uuid := strings.TrimSpace(string(data))
+	if uuid == "" {
+		return "", errors.New("empty device UUID")
+	}
+	return uuid, nil
+}
+
+// removePendingDeviceUUID removes the device UUID kept for the PIN step
+func removePendingDeviceUUID() {
+	if path, err := pendingDeviceUUIDPath(); err == nil {
+		os.Remove(path)
+	}
+}
+
+// pairStatusCmd represents the pair status command
+var pairStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Display the PIN page state",
+	Long:  `Display whether the pairing PIN page is currently shown by the TV.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := newBackend(tvBackend, server, tvPorts, samtv.Credentials{})
+		if err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+		r, ok := b.(samtv.Remote)
+		if !ok {
+			logrus.Errorf("The PIN page is not available with the %s backend", b.Name())
+			os.Exit(1)
+		}
+		st, err := r.PINPageState()
+		if err != nil {
+			logrus.Error("Cannot get PIN page state: ", err)
+			os.Exit(1)
+		}
+		fmt.Printf("PIN page: %s\n", st)
+	},
+}
+
+// pairVerifyCmd represents the pair verify command
+var pairVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the stored credentials",
+	Long: `Check the stored session credentials are accepted by the TV.
+
+With the smartview backend, an encrypted request is sent to the TV; if
+the TV rejects it, a new pairing is required.  With the tizen backend,
+the token is verified when the connection is opened.  The credentials
+cannot be verified with the legacy backend.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := loadCredentials()
+		if err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+		if !hasCredentials(tvBackend, c) {
+			fmt.Println("No stored credentials: pairing is required.")
+			os.Exit(1)
+		}
+		err = verifyCredentials(c)
+		if err == errCannotVerify {
+			fmt.Printf("The credentials cannot be verified with the %s backend.\n",
+				backendName(tvBackend))
+			os.Exit(1)
+		}
+		if err != nil && !samtv.IsInvalidCredentials(err) {
+			fmt.Printf("Cannot verify the credentials: connection failed (%v).\n", err)
+			os.Exit(1)
+		}
+		if err != nil {
+			logrus.Debug("Verification error: ", err)
+			fmt.Printf("The credentials do not work (%v).\n", err)
+			fmt.Println("Pairing is required: use 'samtvcli pair --interactive --save'.")
+			os.Exit(1)
+		}
+		fmt.Println("The credentials are valid.")
+	},
+}
+
+// errCannotVerify is returned by verifyCredentials when the backend
+// cannot check the credentials with a request
+var errCannotVerify = errors.New("the credentials cannot be verified")
+
+// verifyCredentials checks the TV accepts the session credentials
+func verifyCredentials(c samtv.Credentials) error {
+	b, err := newSession(tvBackend, server, tvPorts, c, nil)
+	if b != nil {
+		defer b.Close()
+	}
+	if err != nil {
+		return err
+	}
+	// Send a request if the backend supports it
+	if p, ok := b.(interface{ Ping() error }); ok {
+		return p.Ping()
+	}
+	// The Tizen connection is only opened with a valid token
+	if b.Name() == samtv.TizenBackend {
+		return nil
+	}
+	return errCannotVerify
+}
+
+// hasCredentials returns true if the credentials required by the backend
+// are set.  The legacy TVs only remember the client identifier, which has
+// a default value.
+func hasCredentials(backend string, c samtv.Credentials) bool {
+	switch backendName(backend) {
+	case samtv.SmartViewBackend:
+		return c.SessionKey != "" && c.SessionID > 0
+	case samtv.TizenBackend:
+		return c.Token != ""
+	}
+	return true
+}
+
+// backendName returns the name of the backend, or the default backend name
+func backendName(name string) string {
+	if name == "" {
+		return samtv.SmartViewBackend
+	}
+	return name
+}
+
 func init() {
 	RootCmd.AddCommand(pairCmd)
+	pairCmd.AddCommand(pairStatusCmd)
+	pairCmd.AddCommand(pairVerifyCmd)
 
 	pairingPIN = pairCmd.Flags().Int("pin", 0, "Pairing PIN code")
+	pairInteractive = pairCmd.Flags().BoolP("interactive", "i", false, "Request the PIN code interactively")
+	pairSave = pairCmd.Flags().Bool("save", false, "Save the credentials to the configuration file")
+	pairRandomUUID = pairCmd.Flags().Bool("random-uuid", false, "Generate a random device UUID if none is set")
 }
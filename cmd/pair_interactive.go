@@ -0,0 +1,146 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/McKael/samtv"
+)
+
+// errPairingInterrupted is returned when the user interrupts the pairing
+var errPairingInterrupted = errors.New("pairing interrupted")
+
+// interactivePairing runs the backend pairing process; the PIN code is
+// requested on the terminal until the pairing succeeds.
+// The PIN page is closed on failure or interruption.
+func interactivePairing(b samtv.Backend) (samtv.Credentials, error) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	type result struct {
+		c   samtv.Credentials
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		c, err := b.PairWith(newTerminalPINProvider())
+		done <- result{c, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.c, r.err
+	case <-sigCh:
+		// Close the PIN page; the pending PIN prompt is abandoned
+		fmt.Fprintln(os.Stderr)
+		if r, ok := b.(samtv.Remote); ok {
+			logrus.Info("Interrupted; closing the PIN page...")
+			r.Pair(-1)
+		}
+		return samtv.Credentials{}, errPairingInterrupted
+	}
+}
+
+// stdinReader is shared by the interactive prompts
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// isTerminal returns true if the file is a terminal
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// confirm asks a yes/no question on the terminal
+// The default answer is no.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	line, err := stdinReader.ReadString('\n')
+	if err != nil {
+		fmt.Fprintln(os.Stderr)
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// terminalPINProvider is a samtv.PINProvider reading PIN codes from the
+// terminal
+type terminalPINProvider struct {
+	in *bufio.Reader
+}
+
+func newTerminalPINProvider() *terminalPINProvider {
+	return &terminalPINProvider{in: stdinReader}
+}
+
+// PIN prompts the user for a PIN code
+func (t *terminalPINProvider) PIN(attempt int) (int, error) {
+	for {
+		fmt.Fprint(os.Stderr, "PIN code: ")
+		line, err := t.in.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				fmt.Fprintln(os.Stderr)
+				return 0, errors.New("no PIN code provided")
+			}
+			return 0, err
+		}
+		pin, err := strconv.Atoi(strings.TrimSpace(line))
+		if err != nil || pin <= 0 {
+			fmt.Fprintln(os.Stderr, "Invalid PIN code, please try again.")
+			continue
+		}
+		return pin, nil
+	}
+}
+
+// backupFile copies a file to the same path with a .bak extension
+// Nothing is done if the file does not exist.
+func backupFile(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path+".bak", data, fi.Mode())
+}
@@ -0,0 +1,209 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/McKael/samtv"
+)
+
+// tvProfile contains the settings for a TV device
+// Profiles are defined in the "tvs" section of the configuration file.
+type tvProfile struct {
+	Server      string              `mapstructure:"server"`
+	SessionKey  string              `mapstructure:"session_key"`
+	SessionID   int                 `mapstructure:"session_id"`
+	DeviceUUID  string              `mapstructure:"device_uuid"`
+	AppID       string              `mapstructure:"app_id"`
+	UserID      string              `mapstructure:"user_id"`
+	Token       string              `mapstructure:"token"`
+	Keybindings string              `mapstructure:"keybindings"`
+	Macros      map[string][]string `mapstructure:"macros"`
+	Apps        map[string]string   `mapstructure:"apps"`
+	Sources     map[string][]string `mapstructure:"sources"`
+	Lineup      []lineupEntry       `mapstructure:"lineup"`
+
+	ChannelKeyDelay   time.Duration `mapstructure:"channel_key_delay"`
+	ChannelEnterDelay time.Duration `mapstructure:"channel_enter_delay"`
+	Ports             samtv.Ports   `mapstructure:"ports"`
+	Backend           string        `mapstructure:"backend"`
+	ModelYear         int           `mapstructure:"model_year"`
+
+	Credentials      credentialStoreConfig `mapstructure:"credentials"`
+	RandomDeviceUUID bool                  `mapstructure:"random_device_uuid"`
+}
+
+// tvName is the name of the selected TV profile
+var tvName string
+
+// currentTV contains the selected TV profile, if any
+var currentTV *tvProfile
+
+// tvPorts contains the service ports of the selected TV
+// Zero values are replaced by the library defaults.
+var tvPorts samtv.Ports
+
+// tvBackend is the name of the backend used for the selected TV
+var tvBackend string
+
+// getTVProfiles returns the TV profiles from the configuration file
+// Note that Viper converts the profile names to lowercase.
+func getTVProfiles() (map[string]tvProfile, error) {
+	var profiles map[string]tvProfile
+	if err := viper.UnmarshalKey("tvs", &profiles); err != nil {
+		return nil, errors.Wrap(err, "cannot parse TV profiles")
+	}
+	return profiles, nil
+}
+
+// getTVProfileNames returns the sorted list of TV profile names
+func getTVProfileNames() []string {
+	profiles, err := getTVProfiles()
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadTVProfile returns the TV profile with the given name
+func loadTVProfile(name string) (*tvProfile, error) {
+	profiles, err := getTVProfiles()
+	if err != nil {
+		return nil, err
+	}
+	p, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		return nil, errors.Errorf("unknown TV profile '%s'", name)
+	}
+	return &p, nil
+}
+
+// applyTVProfile sets the session parameters from the TV profile
+// Values provided on the command line take precedence; the global settings
+// are only overridden by the items set in the profile.
+func applyTVProfile(p *tvProfile) {
+	flags := RootCmd.PersistentFlags()
+	if !flags.Changed("server") && p.Server != "" {
+		server = p.Server
+	}
+	if !flags.Changed("device-uuid") && p.DeviceUUID != "" {
+		smartDeviceID = p.DeviceUUID
+	}
+	if !flags.Changed("session-key") && p.SessionKey != "" {
+		smartSessionKey = p.SessionKey
+	}
+	if !flags.Changed("session-id") && p.SessionID > 0 {
+		smartSessionID = p.SessionID
+	}
+	tvPorts = tvPorts.Merge(p.Ports)
+	if !flags.Changed("backend") && p.Backend != "" {
+		tvBackend = p.Backend
+	}
+}
+
+// profileBackend returns the backend name for the TV profile
+func profileBackend(p *tvProfile) string {
+	if p.Backend != "" {
+		return p.Backend
+	}
+	return viper.GetString("backend")
+}
+
+// completeBackendNames provides shell completion for the --backend flag
+func completeBackendNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return samtv.Backends(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// getPorts returns the TV service ports from the configuration file
+func getPorts() samtv.Ports {
+	var ports samtv.Ports
+	if err := viper.UnmarshalKey("ports", &ports); err != nil {
+		logrus.Warn("Cannot parse TV ports: ", err)
+	}
+	return ports
+}
+
+// profileCachePath returns the path of a cache file of the selected TV
+// profile, e.g. ~/.cache/samtvcli/channels-living.json
+func profileCachePath(prefix, ext string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	name := tvName
+	if name == "" {
+		name = "default"
+	}
+	return filepath.Join(dir, AppName, prefix+"-"+name+ext), nil
+}
+
+// getMacros returns the macros for the given TV profile
+// Global macros can be overridden in the TV profile.
+func getMacros(p *tvProfile) map[string][]string {
+	macros := make(map[string][]string)
+	for name, keys := range viper.GetStringMapStringSlice("macros") {
+		macros[name] = keys
+	}
+	if p != nil {
+		for name, keys := range p.Macros {
+			macros[name] = keys
+		}
+	}
+	return macros
+}
+
+// loadCompletionConfig reads the configuration file given with --config
+// The configuration has been initialized before the flag was parsed by the
+// completion command.
+func loadCompletionConfig() {
+	if cfgFile != "" && cfgFile != "/dev/null" && cfgFile != viper.ConfigFileUsed() {
+		viper.SetConfigFile(cfgFile)
+		viper.ReadInConfig()
+	}
+}
+
+// completeTVNames provides shell completion for the --tv flag
+func completeTVNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	loadCompletionConfig()
+
+	var names []string
+	for _, name := range getTVProfileNames() {
+		if strings.HasPrefix(name, strings.ToLower(toComplete)) {
+			names = append(names, name)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
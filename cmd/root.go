@@ -45,7 +45,9 @@ var RootCmd = &cobra.Command{
 	Use:   AppName,
 	Short: "A CLI remote for Samsung smart TVs",
 	Long: `This utility is a command-line interface to send commands to a
-Samung "Smart TV" model H/J (2014/2015).`,
+Samung "Smart TV" model H/J (2014/2015).
+Tizen models (2016+) are supported with the tizen backend, and the older
+C/D/E/F models with the legacy backend.`,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -63,7 +65,9 @@ func init() {
 	// Define your flags and configuration settings.
 	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "",
 		"config file (default is $HOME/.config/"+AppName+"/"+AppName+".yaml)")
+	RootCmd.PersistentFlags().StringVar(&tvName, "tv", "", "TV profile name")
 	RootCmd.PersistentFlags().StringVar(&server, "server", "", "TV IP address")
+	RootCmd.PersistentFlags().StringVar(&tvBackend, "backend", "", "TV remote control backend")
 	RootCmd.PersistentFlags().StringVar(&smartDeviceID, "device-uuid", "", "SmartView Device UUID")
 	RootCmd.PersistentFlags().StringVar(&smartSessionKey, "session-key", "", "SmartView session key")
 	RootCmd.PersistentFlags().IntVar(&smartSessionID, "session-id", -1, "SmartView session ID")
@@ -72,9 +76,13 @@ func init() {
 	// Configuration file bindings
 	viper.BindPFlag("server", RootCmd.PersistentFlags().Lookup("server"))
 	viper.BindPFlag("debug", RootCmd.PersistentFlags().Lookup("debug"))
+	viper.BindPFlag("backend", RootCmd.PersistentFlags().Lookup("backend"))
 	viper.BindPFlag("session_key", RootCmd.PersistentFlags().Lookup("session-key"))
 	viper.BindPFlag("session_id", RootCmd.PersistentFlags().Lookup("session-id"))
 	viper.BindPFlag("device_uuid", RootCmd.PersistentFlags().Lookup("device-uuid"))
+
+	RootCmd.RegisterFlagCompletionFunc("tv", completeTVNames)
+	RootCmd.RegisterFlagCompletionFunc("backend", completeBackendNames)
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -123,4 +131,28 @@ func initConfig() {
 	smartDeviceID = viper.GetString("device_uuid")
 	smartSessionKey = viper.GetString("session_key")
 	smartSessionID = viper.GetInt("session_id")
+	tvPorts = getPorts()
+	tvBackend = viper.GetString("backend")
+
+	// Select the TV profile
+	fromDefault := false
+	if tvName == "" {
+		tvName = viper.GetString("default")
+		fromDefault = tvName != ""
+	}
+	if tvName != "" {
+		p, err := loadTVProfile(tvName)
+		if err != nil && fromDefault {
+			// Keep the CLI usable to fix the configuration
+			logrus.Warnf("Default TV profile: %v", err)
+			tvName = ""
+			return
+		}
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		logrus.Debugf("Using TV profile '%s'", tvName)
+		currentTV = p
+		applyTVProfile(p)
+	}
 }
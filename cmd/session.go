@@ -1,38 +1,211 @@
 package cmd
 
 import (
-	"encoding/hex"
+	"os"
+	"sync"
 	//"time"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 
 	"github.com/McKael/samtv"
 )
 
-// initSession creates a new SmartViewSession and initialies the connection
-func initSession() (*samtv.SmartViewSession, error) {
-	// TODO: pre-check server
+// initSession creates a new session with the selected TV and
+// initializes the connection
+func initSession() (samtv.Backend, error) {
+	store, err := getCredentialStore(tvName, currentTV)
+	if err != nil {
+		return nil, err
+	}
+	c, err := loadCredentials()
+	if err != nil {
+		return nil, err
+	}
+	return newSession(tvBackend, server, tvPorts, c, store)
+}
+
+// initSessionOrRepair initializes a session for the selected TV and offers
+// to pair again if the TV rejects the stored credentials
+func initSessionOrRepair() (samtv.Backend, error) {
+	s, err := initSession()
+	if err == nil || !offerRepairing(err) {
+		return s, err
+	}
+	if s != nil {
+		s.Close()
+	}
+	return initSession()
+}
+
+// runWithSession initializes a session for the selected TV and runs the
+// action.  If the TV rejects the stored credentials, the user is offered
+// to pair again and the action is run once more with the new session.
+func runWithSession(action func(samtv.Backend) error) error {
+	run := func() error {
+		s, err := initSession()
+		if s != nil {
+			defer s.Close()
+		}
+		if err != nil {
+			return errors.Wrap(err, "cannot initialize session")
+		}
+		return action(s)
+	}
+
+	err := run()
+	if err == nil || !offerRepairing(err) {
+		return err
+	}
+	return run()
+}
+
+// offerRepairing checks if the error is due to invalid credentials and
+// offers to pair again with the TV.  It returns true if the pairing
+// succeeded and the new credentials have been saved.
+func offerRepairing(err error) bool {
+	if !samtv.IsInvalidCredentials(err) {
+		return false
+	}
+	logrus.Warn("The TV rejected the stored credentials: ", err)
+	if !isTerminal(os.Stdin) {
+		logrus.Info("Pairing is required: use 'samtvcli pair --interactive --save'.")
+		return false
+	}
+	if !confirm("Pair with the TV now?") {
+		return false
+	}
+	if err := pairAgain(); err != nil {
+		logrus.Error("Pairing error: ", err)
+		return false
+	}
+	logrus.Info("The new credentials have been saved")
+	return true
+}
 
-	s, err := samtv.NewSmartViewSession(server)
+// pairAgain runs the interactive pairing process with the current pairing
+// identity and saves the new credentials
+func pairAgain() error {
+	id, err := loadCredentials()
+	if err != nil {
+		return err
+	}
+	b, err := newBackend(tvBackend, server, tvPorts, pairingIdentity(id))
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	c, err := interactivePairing(b)
+	if err != nil {
+		return err
+	}
+	return saveCredentials(c)
+}
+
+// pairingIdentity returns the pairing identity part of the credentials
+func pairingIdentity(c samtv.Credentials) samtv.Credentials {
+	return samtv.Credentials{
+		DeviceUUID: c.DeviceUUID,
+		AppID:      c.AppID,
+		UserID:     c.UserID,
+	}
+}
+
+// loadProfileCredentials loads the credentials of the given TV profile
+// The credential stores may prompt the user, so this must not be called
+// concurrently.
+func loadProfileCredentials(name string, p *tvProfile) (samtv.Credentials, error) {
+	store, err := getCredentialStore(name, p)
+	if err != nil {
+		return samtv.Credentials{}, err
+	}
+	c, err := store.Load()
+	if err != nil {
+		return samtv.Credentials{}, errors.Wrap(err, "cannot load credentials")
+	}
+	return c, nil
+}
+
+// initProfileSession creates a new session for the given TV profile
+// and initializes the connection
+func initProfileSession(name string, p *tvProfile, c samtv.Credentials) (samtv.Backend, error) {
+	store, err := getCredentialStore(name, p)
 	if err != nil {
 		return nil, err
 	}
+	return newSession(profileBackend(p), p.Server, getPorts().Merge(p.Ports), c, store)
+}
 
-	// Pre-check session key (16 hex values)
-	// Hex conversion will be done later, so the pre-check only verifies
-	// there are 32 chars.
-	if l := len(smartSessionKey); l != 0 && l != 32 {
-		return nil, errors.New("invalid session key, should be a 32-byte hex string")
+// newBackend creates a backend for the TV with the given credentials,
+// without opening the connection
+func newBackend(name, tvAddress string, ports samtv.Ports, c samtv.Credentials) (samtv.Backend, error) {
+	// TODO: pre-check server
+
+	b, err := samtv.NewBackend(name, samtv.BackendOptions{
+		Address:     tvAddress,
+		Ports:       ports,
+		Credentials: c,
+	})
+	if err != nil {
+		return nil, err
 	}
+	logrus.Debugf("Using the %s backend", b.Name())
+	return b, nil
+}
 
-	// Use existing session
-	sessionKey, err := hex.DecodeString(smartSessionKey)
+// newSession creates a backend for the TV with the given credentials
+// and initializes the connection.  If a store is given, the credentials
+// sent by the TV during the connection (e.g. a new Tizen token) are saved.
+func newSession(name, tvAddress string, ports samtv.Ports, c samtv.Credentials, store credentialStore) (samtv.Backend, error) {
+	b, err := newBackend(name, tvAddress, ports, c)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot convert hex key string")
+		return nil, err
+	}
+	if n, ok := b.(credentialsNotifier); ok && store != nil {
+		n.SetCredentialsChangedFunc(func(nc samtv.Credentials) {
+			if err := saveChangedCredentials(store, c, nc); err != nil {
+				logrus.Error("Could not save the new credentials: ", err)
+			}
+		})
 	}
+	return b, b.Connect()
+}
+
+// credentialsNotifier is implemented by the backends that can report
+// new credentials
+type credentialsNotifier interface {
+	SetCredentialsChangedFunc(f samtv.CredentialsChangedFunc)
+}
 
-	s.RestoreSessionData(sessionKey, smartSessionID, smartDeviceID)
+// credentialsSaveMutex serializes the credentials updates, since the
+// group sessions are opened concurrently
+var credentialsSaveMutex sync.Mutex
+
+// saveChangedCredentials merges the new non-empty credentials with the
+// loaded ones and saves them to the store
+func saveChangedCredentials(store credentialStore, c, nc samtv.Credentials) error {
+	if nc.DeviceUUID != "" {
+		c.DeviceUUID = nc.DeviceUUID
+	}
+	if nc.SessionKey != "" {
+		c.SessionKey = nc.SessionKey
+	}
+	if nc.SessionID > 0 {
+		c.SessionID = nc.SessionID
+	}
+	if nc.AppID != "" {
+		c.AppID = nc.AppID
+	}
+	if nc.UserID != "" {
+		c.UserID = nc.UserID
+	}
+	if nc.Token != "" {
+		c.Token = nc.Token
+	}
 
-	err = s.InitSession()
-	return s, err
+	credentialsSaveMutex.Lock()
+	defer credentialsSaveMutex.Unlock()
+	logrus.Info("Saving the new credentials sent by the TV")
+	return store.Save(c)
 }
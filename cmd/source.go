@@ -0,0 +1,196 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/McKael/samtv"
+)
+
+// defaultSourceKeys contains the built-in source key sequences, used when
+// the TV source service is not available
+var defaultSourceKeys = map[string][]string{
+	"tv":    {"KEY_TV"},
+	"hdmi1": {"KEY_HDMI1"},
+	"hdmi2": {"KEY_HDMI2"},
+	"hdmi3": {"KEY_HDMI3"},
+	"hdmi4": {"KEY_HDMI4"},
+}
+
+// sourceCmd represents the source command
+var sourceCmd = &cobra.Command{
+	Use:   "source",
+	Short: "Manage the TV input source",
+	Long: `This command can be used to list and select the TV input sources.
+
+The source list service of the H/J models is used.  When it is not
+available, the source is selected with a key sequence; the sequences can
+be defined in the "sources" section of the configuration file or of the
+TV profile.`,
+	Example: `  samtvcli source list
+  samtvcli source get
+  samtvcli source set HDMI2`,
+}
+
+// sourceListCmd represents the source list command
+var sourceListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the input sources",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		a, err := samtv.NewMainTVAgent(server, tvPorts)
+		var sources []samtv.TVSource
+		if err == nil {
+			sources, err = a.Sources()
+		}
+		if err != nil {
+			logrus.Info("Source list not available: ", err)
+			logrus.Info("Sources defined with key sequences:")
+			keys := getSourceKeys(currentTV)
+			var names []string
+			for name := range keys {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Printf("%s\t%s\n", name, strings.Join(keys[name], " "))
+			}
+			return
+		}
+
+		current, _ := a.CurrentSource()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  SOURCE\tID\tCONNECTED\tDEVICE")
+		for _, s := range sources {
+			mark := " "
+			if s.Type == current {
+				mark = "*"
+			}
+			connected := "no"
+			if s.Connected {
+				connected = "yes"
+			}
+			fmt.Fprintf(w, "%s %s\t%d\t%s\t%s\n", mark, s.Type, s.ID, connected, s.Name)
+		}
+		w.Flush()
+	},
+}
+
+// sourceGetCmd represents the source get command
+var sourceGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Display the current input source",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		a, err := samtv.NewMainTVAgent(server, tvPorts)
+		if err != nil {
+			logrus.Error("Cannot find the TV agent service: ", err)
+			os.Exit(1)
+		}
+		src, err := a.CurrentSource()
+		if err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+		fmt.Println(src)
+	},
+}
+
+// sourceSetCmd represents the source set command
+var sourceSetCmd = &cobra.Command{
+	Use:   "set NAME",
+	Short: "Select an input source",
+	Long: `Select an input source.
+
+The name is a source type (e.g. HDMI2), a connected device name, or the
+name of a key sequence of the "sources" configuration section.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := setSource(args[0]); err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(sourceCmd)
+	sourceCmd.AddCommand(sourceListCmd)
+	sourceCmd.AddCommand(sourceGetCmd)
+	sourceCmd.AddCommand(sourceSetCmd)
+}
+
+// setSource selects a source with the TV agent service, or with the
+// source key sequence
+func setSource(name string) error {
+	a, err := samtv.NewMainTVAgent(server, tvPorts)
+	if err == nil {
+		var sources []samtv.TVSource
+		if sources, err = a.Sources(); err == nil {
+			src, ok := samtv.FindSource(sources, name)
+			if !ok {
+				err = errors.Errorf("unknown source '%s'", name)
+			} else if err = a.SetSource(src); err == nil {
+				logrus.Debugf("Selected source %s (%d)", src.Type, src.ID)
+				return nil
+			}
+		}
+	}
+
+	keys, ok := getSourceKeys(currentTV)[strings.ToLower(name)]
+	if !ok {
+		return errors.Wrap(err, "cannot select source")
+	}
+	logrus.Debugf("Source service not available (%v), using keys %v", err, keys)
+	return runWithSession(func(s samtv.Backend) error {
+		return sendKeys(s, expandMacros(keys, currentTV))
+	})
+}
+
+// getSourceKeys returns the source key sequences for the given TV profile
+// The built-in sequences can be overridden in the "sources" section of the
+// configuration file or of the TV profile.
+func getSourceKeys(p *tvProfile) map[string][]string {
+	sources := make(map[string][]string)
+	for name, keys := range defaultSourceKeys {
+		sources[name] = keys
+	}
+	for name, keys := range viper.GetStringMapStringSlice("sources") {
+		sources[name] = keys
+	}
+	if p != nil {
+		for name, keys := range p.Sources {
+			sources[strings.ToLower(name)] = keys
+		}
+	}
+	return sources
+}
@@ -27,6 +27,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/jroimartin/gocui"
 	"github.com/pkg/errors"
@@ -39,6 +40,12 @@ import (
 
 var logHeight = 7 // Log window height
 
+// tuiStatusInterval is the delay between TV status updates
+const tuiStatusInterval = 3 * time.Second
+
+// tuiStatusRefresh is used to request a TV status update
+var tuiStatusRefresh = make(chan struct{}, 1)
+
 var tuiKeybindingsConfigFile *string
 var tuiLogFile *string
 var tuiLogWriter *io.PipeWriter
@@ -52,6 +59,9 @@ var tuiCmd = &cobra.Command{
 		// Load keybindings
 		tuiBindingsYAML := tuiDefaultBindingsYAML
 		keybindingsFile := viper.GetString("keybindings")
+		if currentTV != nil && currentTV.Keybindings != "" && !cmd.Flags().Changed("keybindings") {
+			keybindingsFile = currentTV.Keybindings
+		}
 		if keybindingsFile != "" {
 			// User-provided bindings
 			cfbytes, err := ioutil.ReadFile(keybindingsFile)
@@ -66,7 +76,7 @@ var tuiCmd = &cobra.Command{
 		}
 
 		// Start SmartView Session
-		samtvSession, err := initSession()
+		samtvSession, err := initSessionOrRepair()
 		if err != nil {
 			logrus.Error("Cannot initialize session: ", err)
 			os.Exit(1)
@@ -88,7 +98,7 @@ func init() {
 	viper.BindPFlag("keybindings", tuiCmd.Flags().Lookup("keybindings"))
 }
 
-func tui(samtvSession *samtv.SmartViewSession) {
+func tui(samtvSession samtv.Backend) {
 	if *tuiLogFile != "" {
 		if f, err := os.OpenFile(*tuiLogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600); err != nil {
 			logrus.Fatal("Could not open log file: ", err)
@@ -126,7 +136,11 @@ func tui(samtvSession *samtv.SmartViewSession) {
 		logrus.Fatal("Cannot setup key bindings: ", err)
 	}
 
+	stopStatus := make(chan struct{})
+	go tuiUpdateStatus(g, stopStatus)
+
 	err = g.MainLoop()
+	close(stopStatus)
 	if tuiLogWriter != nil {
 		tuiLogWriter.Close()
 	} else {
@@ -205,7 +219,7 @@ Dynamic bindings:
 	return nil
 }
 
-func setupKeyBindings(g *gocui.Gui, samtvs *samtv.SmartViewSession, keyBindings map[string]string) error {
+func setupKeyBindings(g *gocui.Gui, samtvs samtv.Backend, keyBindings map[string]string) error {
 	var errs []error
 
 	errs = append(errs,
@@ -287,13 +301,17 @@ func uiToggleDebug(g *gocui.Gui, v *gocui.View) error {
 	return nil
 }
 
-func genKeyhandler(s *samtv.SmartViewSession, keyID string) func(*gocui.Gui, *gocui.View) error {
+func genKeyhandler(s samtv.Backend, keyID string) func(*gocui.Gui, *gocui.View) error {
 	return func(g *gocui.Gui, v *gocui.View) error {
 		if strings.HasPrefix(keyID, "TUI_") {
 			return tuiInternalCommand(g, v, keyID)
 		}
 
-		if !strings.HasPrefix(keyID, "KEY_") {
+		// HOLD_KEY_X keeps the key pressed for a while
+		hold := strings.HasPrefix(keyID, tuiHoldPrefix+"KEY_")
+		key := strings.TrimPrefix(keyID, tuiHoldPrefix)
+
+		if !strings.HasPrefix(key, "KEY_") {
 			return errors.New("invalid key identifier in shortcut")
 		}
 
@@ -302,11 +320,18 @@ func genKeyhandler(s *samtv.SmartViewSession, keyID string) func(*gocui.Gui, *go
 
 		go func() {
 			var msg string
-			if err := s.Key(keyID); err != nil {
+			var err error
+			if hold {
+				err = holdKey(s, key, tuiHoldDuration)
+			} else {
+				err = s.Key(key)
+			}
+			if err != nil {
 				msg = fmt.Sprintf("Failed to send Key %s", keyID)
 				logrus.Error("Cannot send key: ", err)
 			} else {
 				msg = fmt.Sprintf("Key sent successfully (%s)", keyID)
+				tuiRequestStatus()
 			}
 			// Use gocui.Update to display log message since we're
 			// in a goroutine
@@ -319,6 +344,76 @@ func genKeyhandler(s *samtv.SmartViewSession, keyID string) func(*gocui.Gui, *go
 	}
 }
 
+// Long key presses in the TUI
+const (
+	tuiHoldPrefix   = "HOLD_"
+	tuiHoldDuration = 2 * time.Second
+)
+
+// tuiRequestStatus requests a TV status update
+func tuiRequestStatus() {
+	select {
+	case tuiStatusRefresh <- struct{}{}:
+	default:
+	}
+}
+
+// tuiUpdateStatus periodically displays the TV volume and the current
+// program in the main window title, if the TV services are available
+func tuiUpdateStatus(g *gocui.Gui, stop <-chan struct{}) {
+	rc, err := samtv.NewRenderingControl(server, tvPorts)
+	if err != nil {
+		logrus.Info("Volume display not available: ", err)
+		rc = nil
+	}
+	agent, err := samtv.NewMainTVAgent(server, tvPorts)
+	if err != nil {
+		logrus.Debug("Program display not available: ", err)
+		agent = nil
+	}
+	if rc == nil && agent == nil {
+		return
+	}
+
+	ticker := time.NewTicker(tuiStatusInterval)
+	defer ticker.Stop()
+	for {
+		var status []string
+		if rc != nil {
+			if v, err := rc.GetVolume(); err != nil {
+				logrus.Debug("Cannot get volume: ", err)
+				status = append(status, "Volume: ?")
+			} else if mute, _ := rc.GetMute(); mute {
+				status = append(status, fmt.Sprintf("Volume: %d (muted)", v))
+			} else {
+				status = append(status, fmt.Sprintf("Volume: %d", v))
+			}
+		}
+		if agent != nil {
+			if np, err := agent.NowPlaying(); err != nil {
+				logrus.Debug("Cannot get current program: ", err)
+			} else if s := nowPlayingStatus(np); s != "" {
+				status = append(status, s)
+			}
+		}
+
+		title := strings.Join(append([]string{"SamTVcli TUI"}, status...), " - ")
+		g.Update(func(g *gocui.Gui) error {
+			if v, err := g.View("main"); err == nil {
+				v.Title = title
+			}
+			return nil
+		})
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-tuiStatusRefresh:
+		}
+	}
+}
+
 func tuiInternalCommand(g *gocui.Gui, v *gocui.View, keyID string) error {
 	switch keyID {
 	case "TUI_QUIT":
@@ -0,0 +1,96 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/McKael/samtv"
+)
+
+// tvsCmd represents the tvs command
+var tvsCmd = &cobra.Command{
+	Use:   "tvs",
+	Short: "Manage TV profiles",
+	Long: `This command can be used to manage the TV profiles.
+
+TV profiles are defined in the "tvs" section of the configuration file;
+the profile can be selected with the --tv flag.  If no profile is selected,
+the "default" profile is used.`,
+}
+
+// tvsListCmd represents the tvs list command
+var tvsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List TV profiles",
+	Long: `Display the TV profiles defined in the configuration file.
+
+The default profile is marked with an asterisk.  The pairing state is
+only displayed for the credentials kept in the configuration file; the
+name of the credentials store is displayed otherwise.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		profiles, err := getTVProfiles()
+		if err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+		if len(profiles) == 0 {
+			logrus.Info("No TV profile defined")
+			return
+		}
+
+		defaultName := strings.ToLower(viper.GetString("default"))
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  NAME\tSERVER\tBACKEND\tPAIRED")
+		for _, name := range getTVProfileNames() {
+			p := profiles[name]
+			mark := " "
+			if name == defaultName {
+				mark = "*"
+			}
+			paired := "no"
+			if s := p.Credentials.Store; s != "" && s != "config" {
+				paired = "(" + s + " store)"
+			} else if (p.SessionKey != "" && p.SessionID > 0) || p.Token != "" {
+				paired = "yes"
+			}
+			backend := profileBackend(&p)
+			if backend == "" {
+				backend = samtv.SmartViewBackend
+			}
+			fmt.Fprintf(w, "%s %s\t%s\t%s\t%s\n", mark, name, p.Server, backend, paired)
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(tvsCmd)
+	tvsCmd.AddCommand(tvsListCmd)
+}
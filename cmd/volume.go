@@ -0,0 +1,128 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/McKael/samtv"
+)
+
+// volumeCmd represents the volume command
+var volumeCmd = &cobra.Command{
+	Use:   "volume [get|set N|+N|-N|mute|unmute]",
+	Short: "Get or set the TV volume",
+	Long: `Get or set the TV volume and mute state.
+
+The absolute volume is read and set using the UPnP RenderingControl
+service of the TV.  Relative values increase or decrease the volume; use
+"--" before a negative value.`,
+	Example: `  samtvcli volume
+  samtvcli volume set 15
+  samtvcli volume +5
+  samtvcli volume -- -5
+  samtvcli volume mute`,
+	Args:      cobra.MaximumNArgs(2),
+	ValidArgs: []string{"get", "set", "mute", "unmute"},
+	Run: func(cmd *cobra.Command, args []string) {
+		rc, err := samtv.NewRenderingControl(server, tvPorts)
+		if err != nil {
+			logrus.Error("Cannot find the TV rendering service: ", err)
+			os.Exit(1)
+		}
+		if err := runVolumeCommand(rc, args); err != nil {
+			logrus.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(volumeCmd)
+}
+
+// runVolumeCommand handles the volume command arguments
+func runVolumeCommand(rc *samtv.RenderingControl, args []string) error {
+	op := "get"
+	if len(args) > 0 {
+		op = args[0]
+	}
+	if op != "set" && len(args) > 1 {
+		return errors.New("too many arguments")
+	}
+
+	switch {
+	case op == "get":
+		return printVolume(rc)
+	case op == "mute", op == "unmute":
+		return rc.SetMute(op == "mute")
+	case op == "set":
+		if len(args) != 2 {
+			return errors.New("missing volume value")
+		}
+		v, err := strconv.Atoi(args[1])
+		if err != nil || v < 0 {
+			return errors.Errorf("invalid volume value '%s'", args[1])
+		}
+		return rc.SetVolume(v)
+	case strings.HasPrefix(op, "+"), strings.HasPrefix(op, "-"):
+		delta, err := strconv.Atoi(op)
+		if err != nil {
+			return errors.Errorf("invalid volume change '%s'", op)
+		}
+		v, err := rc.GetVolume()
+		if err != nil {
+			return err
+		}
+		v += delta
+		if v < 0 {
+			v = 0
+		}
+		logrus.Debug("New volume: ", v)
+		return rc.SetVolume(v)
+	}
+	return errors.Errorf("unknown volume operation '%s'", op)
+}
+
+// printVolume displays the volume and the mute state
+func printVolume(rc *samtv.RenderingControl) error {
+	v, err := rc.GetVolume()
+	if err != nil {
+		return err
+	}
+	mute, err := rc.GetMute()
+	if err != nil {
+		return err
+	}
+	if mute {
+		fmt.Printf("Volume: %d (muted)\n", v)
+	} else {
+		fmt.Printf("Volume: %d\n", v)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// PairingMaxAttempts is the number of PIN codes requested from a PINProvider
+// before the pairing is abandoned
+const PairingMaxAttempts = 3
+
+// ErrInvalidCredentials is returned (possibly wrapped) when the TV does not
+// accept the session credentials, e.g. after a factory reset.
+// A new pairing is required.
+var ErrInvalidCredentials = errors.New("invalid session credentials")
+
+// IsInvalidCredentials returns true if the error is caused by invalid
+// session credentials
+func IsInvalidCredentials(err error) bool {
+	return err != nil && errors.Cause(err) == ErrInvalidCredentials
+}
+
+// Credentials contains the data required to restore a SmartView session
+type Credentials struct {
+	DeviceUUID string // Device Identifier
+	SessionID  int    // Session ID
+	SessionKey string // Session encryption key (hex string)
+	AppID      string // Application identifier used for pairing
+	UserID     string // User identifier used for pairing
+	Token      string // Access token (Tizen backend)
+}
+
+// PINProvider is used to get the PIN code displayed by the TV during pairing
+type PINProvider interface {
+	// PIN returns the PIN code typed by the user.
+	// The attempt number starts at 1.
+	PIN(attempt int) (int, error)
+}
+
+// PINProviderFunc is an adapter to use a function as a PINProvider
+type PINProviderFunc func(attempt int) (int, error)
+
+// PIN calls f(attempt)
+func (f PINProviderFunc) PIN(attempt int) (int, error) {
+	return f(attempt)
+}
+
+// CredentialsChangedFunc is the type of the function called when new
+// session credentials have been obtained, so that they can be saved
+type CredentialsChangedFunc func(Credentials)
+
+// SetPINProvider sets the PIN provider used by InitSession when the session
+// has no credentials.  If no provider is set, InitSession only opens the
+// PIN page and returns an error.
+func (s *SmartViewSession) SetPINProvider(p PINProvider) {
+	s.pinProvider = p
+}
+
+// SetCredentialsChangedFunc sets a function to be called when new session
+// credentials have been obtained by pairing
+func (s *SmartViewSession) SetCredentialsChangedFunc(f CredentialsChangedFunc) {
+	s.credentialsChanged = f
+}
+
+// Credentials returns the current session credentials
+func (s *SmartViewSession) Credentials() Credentials {
+	c := Credentials{
+		DeviceUUID: s.uuid,
+		SessionID:  s.sessionID,
+		AppID:      s.appID,
+		UserID:     s.userID,
+	}
+	if len(s.sessionKey) > 0 {
+		c.SessionKey = hex.EncodeToString(s.sessionKey)
+	}
+	return c
+}
+
+// GenerateDeviceUUID returns a new random device UUID
+// It can be used to give a distinct identity to each installation.
+func GenerateDeviceUUID() (string, error) {
+	u := make([]byte, 16)
+	if _, err := rand.Read(u); err != nil {
+		return "", errors.Wrap(err, "cannot generate random UUID")
+	}
+	u[6] = (u[6] & 0x0f) | 0x40 // Version 4
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
+
+// PairWith handles the whole pairing process with the TV device:
+// it opens the PIN page, requests the PIN code from the provider and
+// completes the pairing.  The PIN page is closed if the pairing fails.
+// On success, the CredentialsChanged function is called.
+func (s *SmartViewSession) PairWith(p PINProvider) (Credentials, error) {
+	if p == nil {
+		return Credentials{}, errors.New("no PIN provider")
+	}
+
+	if _, _, _, err := s.Pair(0); err != nil {
+		return Credentials{}, errors.Wrap(err, "could not start pairing")
+	}
+
+	for attempt := 1; attempt <= PairingMaxAttempts; attempt++ {
+		pin, err := p.PIN(attempt)
+		if err != nil {
+			s.closePINPage()
+			return Credentials{}, errors.Wrap(err, "could not get PIN code")
+		}
+
+		if _, _, _, err := s.Pair(pin); err != nil {
+			logrus.Errorf("Pairing failed (attempt %d/%d): %v", attempt, PairingMaxAttempts, err)
+			continue
+		}
+
+		c := s.Credentials()
+		if s.credentialsChanged != nil {
+			s.credentialsChanged(c)
+		}
+		return c, nil
+	}
+
+	s.closePINPage()
+	return Credentials{}, errors.New("too many failed attempts")
+}
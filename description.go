@@ -60,7 +60,7 @@ func (s *SmartViewSession) DeviceDescription() (SmartDeviceDescription, error) {
 		return sdd, errors.New("internal error: invalid session, missing TV IP address")
 	}
 
-	d, err := fetchURL("http://" + s.tvAddress + ":8001/ms/1.0/")
+	d, err := fetchURL("http://" + s.serviceAddress(s.ports.Description) + "/ms/1.0/")
 	if err != nil {
 		return sdd, err
 	}
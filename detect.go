@@ -0,0 +1,189 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// probeTimeout is the timeout used to check if a TV service is reachable
+const probeTimeout = 3 * time.Second
+
+// modelYears maps the model-year letters of the Samsung model names to years
+// The letters A and B were also used by the 2008 and 2009 models (e.g.
+// LE40A556, UE32B6000): they are only mapped for the names following the
+// 2021+ naming pattern.
+var modelYears = map[byte]int{
+	'C': 2010, 'D': 2011, 'E': 2012, 'F': 2013,
+	'H': 2014, 'J': 2015, 'K': 2016, 'M': 2017,
+	'N': 2018, 'R': 2019, 'T': 2020, 'A': 2021,
+	'B': 2022,
+}
+
+// Model names look like UE40H6400, UN55JU7100 or QE65Q7FN
+var modelNameRe = regexp.MustCompile(`^[A-Z]{2}\d{2}([A-Z])`)
+
+// Recent model names look like UE43AU7100, QE55Q80AAT or QE65QN95B
+var recentModelNameRe = regexp.MustCompile(`^[A-Z]{2}\d{2}(?:([AB])U\d|QN?\d{2,3}([AB]))`)
+
+// Detection contains the result of the TV protocol detection
+type Detection struct {
+	Backend     string                  // Selected backend
+	Year        int                     // Model year, 0 if unknown
+	Description *SmartDeviceDescription // Device description, if available
+	Reasons     []string                // Explanation of the choice
+}
+
+func (d *Detection) reason(format string, args ...interface{}) {
+	d.Reasons = append(d.Reasons, fmt.Sprintf(format, args...))
+}
+
+// ModelYear returns the year of a TV model from its model name,
+// or 0 if the name is not recognized
+func ModelYear(modelName string) int {
+	if m := recentModelNameRe.FindStringSubmatch(modelName); m != nil {
+		return modelYears[(m[1] + m[2])[0]]
+	}
+	m := modelNameRe.FindStringSubmatch(modelName)
+	if m == nil {
+		return 0
+	}
+	switch letter := m[1][0]; letter {
+	case 'A', 'B':
+		return 0 // 2008/2009 model
+	default:
+		return modelYears[letter]
+	}
+}
+
+// BackendForYear returns the backend supporting the models of a given year,
+// or an empty string if the year is unknown
+func BackendForYear(year int) string {
+	switch {
+	case year == 0:
+		return ""
+	case year < 2014:
+		return LegacyBackend
+	case year < 2016:
+		return SmartViewBackend
+	}
+	return TizenBackend
+}
+
+// DetectBackend probes the TV services and selects the backend
+// The SmartView (/ms/1.0/) and Tizen (/api/v2/) device descriptions are
+// requested, and the legacy service port is checked.  When the model name
+// is available, the model year is used to select the backend.
+func DetectBackend(tvAddress string, ports Ports) (*Detection, error) {
+	if tvAddress == "" {
+		return nil, errors.New("empty TV IP address")
+	}
+	ports = DefaultPorts.Merge(ports)
+	d := &Detection{}
+
+	var smartview, tizen, legacy bool
+
+	if portReachable(tvAddress, ports.Description) {
+		if s, err := NewSmartViewSession(tvAddress); err == nil {
+			s.SetPorts(ports)
+			if desc, err := s.DeviceDescription(); err == nil && desc.ModelName != "" {
+				smartview = true
+				d.Description = &desc
+				d.reason("SmartView description available (/ms/1.0/ on port %d)", ports.Description)
+			} else {
+				logrus.Debug("No SmartView description: ", err)
+			}
+		}
+		if s, err := NewTizenSession(tvAddress); err == nil {
+			s.SetPorts(ports)
+			if desc, err := s.DeviceDescription(); err == nil && desc.ModelName != "" {
+				tizen = true
+				if d.Description == nil {
+					d.Description = &desc
+				}
+				d.reason("Tizen description available (/api/v2/ on port %d)", ports.Description)
+			} else {
+				logrus.Debug("No Tizen description: ", err)
+			}
+		}
+	} else {
+		d.reason("Description service not reachable (port %d)", ports.Description)
+	}
+
+	if portReachable(tvAddress, ports.Legacy) {
+		legacy = true
+		d.reason("Legacy remote service reachable (port %d)", ports.Legacy)
+	}
+
+	available := map[string]bool{
+		SmartViewBackend: smartview,
+		TizenBackend:     tizen,
+		LegacyBackend:    legacy,
+	}
+
+	// The model year is the most reliable hint
+	if d.Description != nil {
+		d.Year = ModelYear(d.Description.ModelName)
+		if d.Year > 0 {
+			b := BackendForYear(d.Year)
+			d.reason("Model %s is a %d model", d.Description.ModelName, d.Year)
+			if available[b] {
+				d.Backend = b
+				d.reason("Selected the %s backend for the %d models", b, d.Year)
+				return d, nil
+			}
+			d.reason("The %s service was not found", b)
+		} else {
+			d.reason("Unknown model year for %s", d.Description.ModelName)
+		}
+	}
+
+	switch {
+	case tizen:
+		d.Backend = TizenBackend
+	case smartview:
+		d.Backend = SmartViewBackend
+	case legacy:
+		d.Backend = LegacyBackend
+	default:
+		return d, errors.New("no supported remote control service found")
+	}
+	d.reason("Selected the %s backend from the available services", d.Backend)
+	return d, nil
+}
+
+// portReachable returns true if a TCP connection can be opened to the port
+func portReachable(tvAddress string, port int) bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(tvAddress, strconv.Itoa(port)), probeTimeout)
+	if err != nil {
+		logrus.Debugf("Port %d not reachable: %v", port, err)
+		return false
+	}
+	conn.Close()
+	return true
+}
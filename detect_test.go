@@ -0,0 +1,54 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv_test
+
+import (
+	"testing"
+
+	"github.com/McKael/samtv"
+)
+
+func TestModelYear(t *testing.T) {
+	tests := []struct {
+		model string
+		year  int
+	}{
+		{"UE40H6400", 2014},
+		{"UE48JU6000", 2015},
+		{"UN55KS8000", 2016},
+		{"UE55NU7400", 2018},
+		{"UE43AU7100", 2021},
+		{"QE55Q80AAT", 2021},
+		{"QE65QN95B", 2022},
+		{"UE43BU8000", 2022},
+		{"LE40A556", 0},  // 2008
+		{"PS50A456", 0},  // 2008
+		{"UE32B6000", 0}, // 2009
+		{"UN46B7000", 0}, // 2009
+		{"QE65Q7FN", 0},
+		{"TV", 0},
+	}
+	for _, tt := range tests {
+		if y := samtv.ModelYear(tt.model); y != tt.year {
+			t.Errorf("ModelYear(%q) = %d, want %d", tt.model, y, tt.year)
+		}
+	}
+}
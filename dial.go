@@ -0,0 +1,253 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DIAL application states
+const (
+	AppRunning = "running"
+	AppStopped = "stopped"
+	AppHidden  = "hidden"
+)
+
+// ErrAppNotFound is returned when the application is not installed
+var ErrAppNotFound = errors.New("application not found")
+
+// dialServiceInfo contains the DIAL application information
+type dialServiceInfo struct {
+	XMLName xml.Name `xml:"service"`
+	Name    string   `xml:"name"`
+	State   string   `xml:"state"`
+	Options struct {
+		AllowStop string `xml:"allowStop,attr"`
+	} `xml:"options"`
+	Link struct {
+		Rel  string `xml:"rel,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"link"`
+	AdditionalData struct {
+		Data string `xml:",innerxml"`
+	} `xml:"additionalData"`
+}
+
+// AppInfo contains the state of a TV application
+type AppInfo struct {
+	Name           string // DIAL application name
+	State          string // AppRunning, AppStopped or AppHidden
+	AllowStop      bool   // The application can be stopped
+	InstanceURL    string // URL of the running instance, if any
+	AdditionalData string // Application specific data (XML)
+}
+
+// DIALClient is a DIAL client used to manage the TV applications
+type DIALClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewDIALClient returns a DIAL client for the given application URL
+// (the DialURI of the device description, e.g.
+// http://192.168.1.50:8080/ws/apps/).
+func NewDIALClient(baseURL string) (*DIALClient, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return nil, errors.New("invalid DIAL application URL")
+	}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	return &DIALClient{
+		baseURL: baseURL,
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}, nil
+}
+
+// NewTVDIALClient returns a DIAL client for the TV
+// The application URL is read from the device description; the pairing
+// service is used if it is not available.
+func NewTVDIALClient(tvAddress string, ports Ports) (*DIALClient, error) {
+	s, err := NewSmartViewSession(tvAddress)
+	if err != nil {
+		return nil, err
+	}
+	s.SetPorts(ports)
+
+	baseURL := "http://" + s.serviceAddress(s.ports.Pairing) + "/ws/apps/"
+	if desc, err := s.DeviceDescription(); err == nil && desc.DialURI != "" {
+		baseURL = desc.DialURI
+	} else {
+		logrus.Debug("Using the default DIAL application URL")
+	}
+	return NewDIALClient(baseURL)
+}
+
+// appURL returns the URL of an application resource
+func (c *DIALClient) appURL(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, "/?#") {
+		return "", errors.Errorf("invalid application name '%s'", name)
+	}
+	return c.baseURL + url.PathEscape(name), nil
+}
+
+// AppStatus returns the state of an application
+func (c *DIALClient) AppStatus(name string) (*AppInfo, error) {
+	u, err := c.appURL(name)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Debug("Fetch URL: ", u)
+	resp, err := c.client.Get(u)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not send request")
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read device response")
+	}
+	logrus.Debugf("DIAL response: `%s`", body)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, errors.Wrap(ErrAppNotFound, name)
+	default:
+		return nil, errors.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	var info dialServiceInfo
+	if err := xml.Unmarshal(body, &info); err != nil {
+		return nil, errors.Wrap(err, "could not parse device response")
+	}
+
+	app := &AppInfo{
+		Name:           info.Name,
+		State:          info.State,
+		AllowStop:      info.Options.AllowStop == "true",
+		AdditionalData: strings.TrimSpace(info.AdditionalData.Data),
+	}
+	if info.Link.Rel == "run" && info.Link.Href != "" {
+		app.InstanceURL = resolveURL(u+"/", info.Link.Href)
+	}
+	return app, nil
+}
+
+// Launch starts an application with an optional payload (e.g. "v=ID"
+// for a YouTube video) and returns the URL of the instance
+func (c *DIALClient) Launch(name, payload string) (string, error) {
+	u, err := c.appURL(name)
+	if err != nil {
+		return "", err
+	}
+	logrus.Debugf("Launching %s with payload `%s`", u, payload)
+	req, err := http.NewRequest("POST", u, strings.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("Content-Length", strconv.Itoa(len(payload)))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "could not send request")
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+	case http.StatusNotFound:
+		return "", errors.Wrap(ErrAppNotFound, name)
+	case http.StatusRequestEntityTooLarge:
+		return "", errors.New("payload too large")
+	case http.StatusServiceUnavailable:
+		return "", errors.New("the application cannot be launched")
+	default:
+		return "", errors.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	instance := resp.Header.Get("Location")
+	if instance == "" {
+		instance = u + "/run"
+	}
+	return resolveURL(u, instance), nil
+}
+
+// Stop terminates a running application
+func (c *DIALClient) Stop(name string) error {
+	app, err := c.AppStatus(name)
+	if err != nil {
+		return err
+	}
+	if app.State != AppRunning && app.State != AppHidden {
+		return errors.Errorf("the application is not running (%s)", app.State)
+	}
+	instance := app.InstanceURL
+	if instance == "" {
+		u, _ := c.appURL(name)
+		instance = u + "/run"
+	}
+
+	logrus.Debug("Stopping ", instance)
+	req, err := http.NewRequest("DELETE", instance, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "could not send request")
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return errors.New("the application instance was not found")
+	case http.StatusNotImplemented:
+		return errors.New("the application cannot be stopped")
+	}
+	return errors.Errorf("unexpected response: %s", resp.Status)
+}
+
+// resolveURL resolves a reference relative to a base URL
+func resolveURL(base, ref string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return b.ResolveReference(r).String()
+}
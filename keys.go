@@ -23,6 +23,7 @@ package samtv
 import (
 	"encoding/json"
 	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -294,6 +295,44 @@ func (s *SmartViewSession) Key(key string) error {
 
 	// TODO:  check the key id is in the list
 
+	if err := s.connect(); err != nil {
+		return err
+	}
+
+	return s.sendKey(key)
+}
+
+// Ping sends an encrypted request without action to the TV device
+// It can be used to check the TV accepts the session credentials: the TV
+// replies with an error (no API is given), but the reply can only be
+// decrypted if the session key is valid, and authorization errors are
+// reported.
+func (s *SmartViewSession) Ping() error {
+	if s == nil {
+		return errors.New("Ping called but no established connection")
+	}
+
+	if err := s.connect(); err != nil {
+		return err
+	}
+
+	m, err := s.sendRequest(s.smartViewJSONBodyPing())
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("TV ping reply: `%s`", m)
+
+	// The error reply for the missing API is expected
+	if _, err := parseSmartMessageResult(m); err != nil {
+		if _, ok := errors.Cause(err).(tvErrorReply); !ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// connect opens the websocket connection if it is not open yet
+func (s *SmartViewSession) connect() error {
 	s.ws.mux.Lock()
 	if s.ws.state == stateNotConnected {
 		s.ws.mux.Unlock()
@@ -304,22 +343,39 @@ func (s *SmartViewSession) Key(key string) error {
 	} else {
 		s.ws.mux.Unlock()
 	}
-
-	return s.sendKey(key)
+	return nil
 }
 
 // sendKey sends a SmartView-formatted message for a key press
 func (s *SmartViewSession) sendKey(text string) error {
-	if s.ws.state != stateConnected {
-		return errors.New("sendKey: no active connection")
+	logrus.Debugf("sendMessage('%s')", text)
+
+	m, err := s.sendRequest(s.smartViewJSONBodyKeyPress(text))
+	if err != nil {
+		return err
 	}
 
-	logrus.Debugf("sendMessage('%s')", text)
+	result, err := parseSmartMessageResult(m)
+	if err != nil {
+		return errors.Wrap(err, "incorrect TV reply")
+	}
+	if result != "" {
+		logrus.Debugf("TV result: `%s`", result)
+	}
+
+	return nil
+}
+
+// sendRequest sends an encrypted request and returns the decrypted reply
+func (s *SmartViewSession) sendRequest(request string) (string, error) {
+	if s.ws.state != stateConnected {
+		return "", errors.New("sendRequest: no active connection")
+	}
 
 	// Encrypt payload
-	data, err := s.aesEncrypt([]byte(s.smartViewJSONBodyKeyPress(text)))
+	data, err := s.aesEncrypt([]byte(request))
 	if err != nil {
-		return errors.Wrap(err, "cannot encrypt message")
+		return "", errors.Wrap(err, "cannot encrypt message")
 	}
 
 	// Convert payload to integer array
@@ -335,25 +391,21 @@ func (s *SmartViewSession) sendKey(text string) error {
 	m := s.buildMessage(body)
 
 	if err := s.sendWSMessage(m); err != nil {
-		return err
+		return "", err
 	}
 
-	m = s.GetMessage(true)
-	if m == "" {
-		return errors.New("no reply from TV")
+	m, err = s.getReply()
+	if err != nil {
+		return "", err
 	}
 
 	logrus.Debugf("TV message: `%s`", m)
 
-	result, err := parseSmartMessageResult("{" + m)
-	if err != nil {
-		return errors.Wrap(err, "incorrect TV reply")
-	}
-	if result != "" {
-		logrus.Debugf("TV result: `%s`", result)
+	// Some replies lack the opening brace
+	if !strings.HasPrefix(m, "{") {
+		m = "{" + m
 	}
-
-	return nil
+	return m, nil
 }
 
 func (s *SmartViewSession) smartViewJSONBodyKeyPress(keyPressed string) string {
@@ -363,14 +415,39 @@ func (s *SmartViewSession) smartViewJSONBodyKeyPress(keyPressed string) string {
 		`","param4":false,"api":"SendRemoteKey","version":"1.000"}}`
 }
 
+func (s *SmartViewSession) smartViewJSONBodyPing() string {
+	return `{"method":"GET","body":{"plugin":"RemoteControl","param1":"uuid:` +
+		s.uuid + `","version":"1.000"}}`
+}
+
+// tvErrorReply is the error reply of a request, when it is not related
+// to the credentials
+type tvErrorReply string
+
+func (e tvErrorReply) Error() string {
+	return "TV error reply: " + string(e)
+}
+
 func parseSmartMessageResult(msg string) (string, error) {
 	res := struct {
 		Result json.RawMessage `json:"result"`
+		Error  json.RawMessage `json:"error"`
 	}{}
 	if err := json.Unmarshal([]byte(msg), &res); err != nil {
 		return "", errors.New("cannot parse message")
 	}
 
+	if len(res.Error) > 0 && string(res.Error) != "null" {
+		// Only authorization errors mean the session is not valid
+		var e struct {
+			Code int `json:"code"`
+		}
+		if json.Unmarshal(res.Error, &e) == nil && (e.Code == 401 || e.Code == 403) {
+			return "", errors.Wrapf(ErrInvalidCredentials, "TV error reply: %s", res.Error)
+		}
+		return "", tvErrorReply(res.Error)
+	}
+
 	rs := string(res.Result)
 
 	// Empty result?
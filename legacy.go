@@ -0,0 +1,328 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// LegacyBackend is the name of the legacy backend (pre-2014 models)
+const LegacyBackend = "legacy"
+
+const (
+	legacyAppString = "iphone..iapp.samsung"
+
+	// The user has to allow the connection on the TV
+	legacyAuthTimeout = 30 * time.Second
+)
+
+// Legacy authentication response codes
+const (
+	legacyAuthResponse = 0x64
+	legacyAuthWaiting  = 0x0a
+	legacyAuthTimedOut = 0x65
+)
+
+// LegacySession is a remote control session with a pre-2014 TV
+// (C/D/E/F series), using the TCP service on port 55000.
+// The TV displays a prompt to allow the connection; it remembers the
+// client identifier afterwards.
+type LegacySession struct {
+	tvAddress string // TV network IP
+	ports     Ports  // TV service ports
+	name      string // Client name displayed by the TV
+	id        string // Client identifier
+
+	mux  sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// NewLegacySession initializes a new LegacySession
+func NewLegacySession(tvAddress string) (*LegacySession, error) {
+	if err := checkTVAddress(tvAddress); err != nil {
+		return nil, err
+	}
+	return &LegacySession{
+		tvAddress: tvAddress,
+		ports:     DefaultPorts,
+		name:      defaultAppID,
+		id:        defaultSessionUUID,
+	}, nil
+}
+
+func newLegacyBackend(opts BackendOptions) (Backend, error) {
+	s, err := NewLegacySession(opts.Address)
+	if err != nil {
+		return nil, err
+	}
+	s.SetPorts(opts.Ports)
+	if err := s.SetCredentials(opts.Credentials); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LegacySession implements the Backend interface
+var _ Backend = (*LegacySession)(nil)
+
+// Name returns the backend name
+func (s *LegacySession) Name() string {
+	return LegacyBackend
+}
+
+// SetPorts sets the TV service ports.  Zero values are ignored.
+func (s *LegacySession) SetPorts(p Ports) {
+	s.ports = s.ports.Merge(p)
+}
+
+// SetCredentials sets the client identifier (DeviceUUID) and name (AppID)
+// Empty values are ignored.
+func (s *LegacySession) SetCredentials(c Credentials) error {
+	if c.DeviceUUID != "" {
+		s.id = c.DeviceUUID
+	}
+	if c.AppID != "" {
+		s.name = c.AppID
+	}
+	return nil
+}
+
+// Credentials returns the client identifier and name
+func (s *LegacySession) Credentials() Credentials {
+	return Credentials{
+		DeviceUUID: s.id,
+		AppID:      s.name,
+	}
+}
+
+// Connect opens the connection to the TV and sends the authentication
+// request.  If the TV does not know the client, the user has to allow the
+// connection on the TV.
+func (s *LegacySession) Connect() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.conn != nil {
+		return nil
+	}
+
+	addr := net.JoinHostPort(s.tvAddress, strconv.Itoa(s.ports.Legacy))
+	logrus.Debug("Connecting to ", addr)
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		return errors.Wrap(err, "cannot connect to the TV")
+	}
+	s.conn, s.r = conn, bufio.NewReader(conn)
+
+	if err := s.authenticate(); err != nil {
+		s.closeConn()
+		return err
+	}
+	return nil
+}
+
+// authenticate sends the authentication request and waits for the result
+// The caller must hold the mutex.
+func (s *LegacySession) authenticate() error {
+	localIP := s.conn.LocalAddr().(*net.TCPAddr).IP.String()
+
+	var payload bytes.Buffer
+	payload.Write([]byte{legacyAuthResponse, 0x00})
+	writeLegacyString(&payload, base64.StdEncoding.EncodeToString([]byte(localIP)))
+	writeLegacyString(&payload, base64.StdEncoding.EncodeToString([]byte(s.id)))
+	writeLegacyString(&payload, base64.StdEncoding.EncodeToString([]byte(s.name)))
+
+	if err := s.writeFrame(payload.Bytes()); err != nil {
+		return err
+	}
+
+	s.conn.SetReadDeadline(time.Now().Add(legacyAuthTimeout))
+	defer s.conn.SetReadDeadline(time.Time{})
+
+	for {
+		p, err := s.readFrame()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return ErrAccessTimeout
+			}
+			return err
+		}
+		if len(p) == 0 {
+			continue
+		}
+		switch p[0] {
+		case legacyAuthResponse:
+			if len(p) >= 3 && p[2] == 0x01 {
+				logrus.Debug("Connection allowed by the TV")
+				return nil
+			}
+			return ErrAccessDenied
+		case legacyAuthWaiting:
+			logrus.Info("Please allow the connection on the TV...")
+		case legacyAuthTimedOut:
+			return ErrAccessTimeout
+		default:
+			logrus.Debugf("Unhandled legacy message: %v", p)
+		}
+	}
+}
+
+// Close terminates the connection
+func (s *LegacySession) Close() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.closeConn()
+}
+
+func (s *LegacySession) closeConn() {
+	if s.conn == nil {
+		return
+	}
+	s.conn.Close()
+	s.conn, s.r = nil, nil
+}
+
+// Key sends a key to the TV
+func (s *LegacySession) Key(key string) error {
+	if key == "" {
+		logrus.Info("Empty key -- ignored")
+		return nil
+	}
+	if err := s.Connect(); err != nil {
+		return errors.Wrap(err, "failed to open connection")
+	}
+
+	var payload bytes.Buffer
+	payload.Write([]byte{0x00, 0x00, 0x00})
+	writeLegacyString(&payload, base64.StdEncoding.EncodeToString([]byte(key)))
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.conn == nil {
+		return errors.New("no active connection")
+	}
+	logrus.Debug("Sending legacy key: ", key)
+	if err := s.writeFrame(payload.Bytes()); err != nil {
+		s.closeConn()
+		return err
+	}
+
+	// Wait for the acknowledgement
+	s.conn.SetReadDeadline(time.Now().Add(replyTimeout))
+	defer s.conn.SetReadDeadline(time.Time{})
+	if _, err := s.readFrame(); err != nil {
+		s.closeConn()
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return errors.New("no reply from TV")
+		}
+		return err
+	}
+	return nil
+}
+
+// PairWith connects to the TV and waits for the user to allow the
+// connection on the TV.  The PIN provider is not used.
+func (s *LegacySession) PairWith(p PINProvider) (Credentials, error) {
+	s.Close()
+	if err := s.Connect(); err != nil {
+		return Credentials{}, err
+	}
+	return s.Credentials(), nil
+}
+
+// DeviceDescription is not supported by the legacy models
+func (s *LegacySession) DeviceDescription() (SmartDeviceDescription, error) {
+	return SmartDeviceDescription{}, ErrNotSupported
+}
+
+// writeFrame sends a message to the TV
+// The caller must hold the mutex.
+func (s *LegacySession) writeFrame(payload []byte) error {
+	var f bytes.Buffer
+	f.WriteByte(0x00)
+	writeLegacyString(&f, legacyAppString)
+	binary.Write(&f, binary.LittleEndian, uint16(len(payload)))
+	f.Write(payload)
+
+	s.conn.SetWriteDeadline(time.Now().Add(15 * time.Second))
+	if _, err := s.conn.Write(f.Bytes()); err != nil {
+		return errors.Wrap(err, "cannot send message")
+	}
+	return nil
+}
+
+// readFrame reads a message from the TV and returns its payload
+// The caller must hold the mutex.
+func (s *LegacySession) readFrame() ([]byte, error) {
+	var t byte
+	if err := binary.Read(s.r, binary.LittleEndian, &t); err != nil {
+		return nil, s.readError(err)
+	}
+	if _, err := readLegacyBytes(s.r); err != nil { // Application string
+		return nil, s.readError(err)
+	}
+	p, err := readLegacyBytes(s.r)
+	if err != nil {
+		return nil, s.readError(err)
+	}
+	logrus.Debugf("Legacy message: %v", p)
+	return p, nil
+}
+
+func (s *LegacySession) readError(err error) error {
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return err
+	}
+	if err == io.EOF {
+		return errors.New("connection closed by the TV")
+	}
+	return errors.Wrap(err, "cannot read message")
+}
+
+// writeLegacyString writes a length-prefixed string
+func writeLegacyString(w *bytes.Buffer, str string) {
+	binary.Write(w, binary.LittleEndian, uint16(len(str)))
+	w.WriteString(str)
+}
+
+// readLegacyBytes reads a length-prefixed byte string
+func readLegacyBytes(r io.Reader) ([]byte, error) {
+	var l uint16
+	if err := binary.Read(r, binary.LittleEndian, &l); err != nil {
+		return nil, err
+	}
+	b := make([]byte, l)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,342 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// MainTVAgentService is the Samsung MainTVAgent2 service type
+const MainTVAgentService = "urn:samsung.com:service:MainTVAgent2:1"
+
+// noMinorChannel is the minor channel number of the channels without
+// sub-channel
+const noMinorChannel = 65534
+
+// MainTVAgent is a client of the Samsung MainTVAgent2 UPnP service (H/J
+// models), used to get information about the current channel and program
+type MainTVAgent struct {
+	svc *upnpService
+}
+
+// TVChannel contains the description of a TV channel
+type TVChannel struct {
+	Type    string `xml:"ChType" json:"type"`
+	Major   int    `xml:"MajorCh" json:"major"`
+	Minor   int    `xml:"MinorCh" json:"minor"`
+	PTC     int    `xml:"PTC" json:"ptc"`
+	ProgNum int    `xml:"ProgNum" json:"prog_num"`
+	Name    string `xml:"DispChName" json:"name,omitempty"`
+
+	Favorite bool `xml:"-" json:"favorite,omitempty"`
+}
+
+// Number returns the channel number ("5" or "5-1")
+func (c TVChannel) Number() string {
+	if c.Minor <= 0 || c.Minor == noMinorChannel {
+		return strconv.Itoa(c.Major)
+	}
+	return strconv.Itoa(c.Major) + "-" + strconv.Itoa(c.Minor)
+}
+
+// ProgramInfo contains information about a TV program
+type ProgramInfo struct {
+	Title       string `json:"title"`
+	ChannelName string `json:"channel_name,omitempty"`
+	StartTime   string `json:"start_time,omitempty"`
+	EndTime     string `json:"end_time,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// NowPlaying contains the current state of the TV
+type NowPlaying struct {
+	Source  string       `json:"source,omitempty"`
+	Channel *TVChannel   `json:"channel,omitempty"`
+	Program *ProgramInfo `json:"program,omitempty"`
+}
+
+// NewMainTVAgent finds the MainTVAgent2 service of the TV
+// The service is discovered with SSDP; if the TV does not answer, the
+// usual description locations on the MainTV port are used.
+func NewMainTVAgent(tvAddress string, ports Ports) (*MainTVAgent, error) {
+	if tvAddress == "" {
+		return nil, errors.New("empty TV IP address")
+	}
+	ports = DefaultPorts.Merge(ports)
+	base := "http://" + net.JoinHostPort(tvAddress, strconv.Itoa(ports.MainTV))
+	svc, err := findUPnPService(tvAddress, MainTVAgentService,
+		base+"/smp_4_", base+"/smp_2_", base+"/smp_8_")
+	if err != nil {
+		return nil, err
+	}
+	return &MainTVAgent{svc: svc}, nil
+}
+
+// call sends a MainTVAgent2 action and checks the result
+func (a *MainTVAgent) call(action string, args ...soapArg) (map[string]string, error) {
+	out, err := a.svc.call(action, args...)
+	if err != nil {
+		return nil, err
+	}
+	if r := out["Result"]; r != "OK" {
+		return nil, errors.Errorf("%s failed: %s", action, r)
+	}
+	return out, nil
+}
+
+// CurrentChannel returns the channel being watched
+func (a *MainTVAgent) CurrentChannel() (TVChannel, error) {
+	var ch TVChannel
+	out, err := a.call("GetCurrentMainTVChannel")
+	if err != nil {
+		return ch, err
+	}
+	if err := xml.Unmarshal([]byte(out["CurrentChannel"]), &ch); err != nil {
+		return ch, errors.Wrap(err, "could not parse channel")
+	}
+	return ch, nil
+}
+
+// CurrentSource returns the current source (e.g. "TV" or "HDMI1")
+func (a *MainTVAgent) CurrentSource() (string, error) {
+	out, err := a.call("GetCurrentExternalSource")
+	if err != nil {
+		return "", err
+	}
+	return out["CurrentExternalSource"], nil
+}
+
+// CurrentProgramInfoURL returns the URL of the current program information
+func (a *MainTVAgent) CurrentProgramInfoURL() (string, error) {
+	out, err := a.call("GetCurrentProgramInformationURL")
+	if err != nil {
+		return "", err
+	}
+	if out["CurrentProgInfoURL"] == "" {
+		return "", errors.New("no program information URL")
+	}
+	return out["CurrentProgInfoURL"], nil
+}
+
+// CurrentProgram returns information about the program being watched
+func (a *MainTVAgent) CurrentProgram() (ProgramInfo, error) {
+	var p ProgramInfo
+	u, err := a.CurrentProgramInfoURL()
+	if err != nil {
+		return p, err
+	}
+	client := &http.Client{Timeout: soapTimeout}
+	resp, err := client.Get(u)
+	if err != nil {
+		return p, errors.Wrap(err, "could not send request")
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return p, errors.Wrap(err, "could not read device response")
+	}
+	return parseProgramInfo(data)
+}
+
+// NowPlaying returns the current source, channel and program
+// The channel and program are only available when the source is the TV
+// tuner.
+func (a *MainTVAgent) NowPlaying() (NowPlaying, error) {
+	var np NowPlaying
+	src, err := a.CurrentSource()
+	if err != nil {
+		return np, err
+	}
+	np.Source = src
+	if src != "" && src != "TV" {
+		return np, nil
+	}
+
+	ch, err := a.CurrentChannel()
+	if err != nil {
+		return np, err
+	}
+	np.Channel = &ch
+	if p, err := a.CurrentProgram(); err == nil {
+		np.Program = &p
+		if ch.Name == "" {
+			ch.Name = p.ChannelName
+		}
+	}
+	return np, nil
+}
+
+// parseProgramInfo parses the program information document
+// The format varies between the models, so the known elements are looked
+// for anywhere in the document.
+func parseProgramInfo(data []byte) (ProgramInfo, error) {
+	var p ProgramInfo
+	fields := map[string]*string{
+		"progtitle":   &p.Title,
+		"title":       &p.Title,
+		"dispchname":  &p.ChannelName,
+		"chname":      &p.ChannelName,
+		"starttime":   &p.StartTime,
+		"endtime":     &p.EndTime,
+		"detailinfo":  &p.Description,
+		"description": &p.Description,
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		t, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		f, ok := fields[strings.ToLower(t.Name.Local)]
+		if !ok || *f != "" {
+			continue
+		}
+		var v string
+		if err := d.DecodeElement(&v, &t); err == nil {
+			*f = strings.TrimSpace(v)
+		}
+	}
+	if p.Title == "" {
+		return p, errors.New("no program information")
+	}
+	return p, nil
+}
+
+// TVSource is an input source of the TV
+type TVSource struct {
+	Type      string `json:"type"`           // Source type, e.g. "HDMI1/DVI"
+	ID        int    `json:"id"`             // Source identifier
+	Name      string `json:"name,omitempty"` // Name of the connected device
+	Connected bool   `json:"connected"`
+}
+
+// Sources returns the input sources of the TV
+func (a *MainTVAgent) Sources() ([]TVSource, error) {
+	out, err := a.call("GetSourceList")
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Sources []struct {
+			Type       string `xml:"SourceType"`
+			ID         int    `xml:"ID"`
+			DeviceName string `xml:"DeviceName"`
+			Connected  string `xml:"Connected"`
+		} `xml:"Source"`
+	}
+	if err := xml.Unmarshal([]byte(out["SourceList"]), &list); err != nil {
+		return nil, errors.Wrap(err, "could not parse source list")
+	}
+
+	sources := make([]TVSource, 0, len(list.Sources))
+	for _, s := range list.Sources {
+		sources = append(sources, TVSource{
+			Type:      s.Type,
+			ID:        s.ID,
+			Name:      s.DeviceName,
+			Connected: parseUPnPBool(s.Connected),
+		})
+	}
+	return sources, nil
+}
+
+// SetSource selects an input source
+func (a *MainTVAgent) SetSource(src TVSource) error {
+	_, err := a.call("SetMainTVSource",
+		soapArg{"Source", src.Type},
+		soapArg{"ID", strconv.Itoa(src.ID)},
+		soapArg{"UiID", "-1"})
+	return err
+}
+
+// FindSource returns the source matching a name
+// The name is compared with the source types and device names, ignoring
+// the case and the punctuation; "hdmi1" matches "HDMI1/DVI".
+func FindSource(sources []TVSource, name string) (TVSource, bool) {
+	n := normalizeName(name)
+	if n == "" {
+		return TVSource{}, false
+	}
+	for _, s := range sources {
+		if normalizeName(s.Type) == n || normalizeName(s.Name) == n {
+			return s, true
+		}
+	}
+	for _, s := range sources {
+		t := strings.SplitN(s.Type, "/", 2)[0]
+		if normalizeName(t) == n {
+			return s, true
+		}
+	}
+	return TVSource{}, false
+}
+
+// normalizeName returns the lowercase letters and digits of a source or
+// channel name
+func normalizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+// SetChannel tunes the TV to a channel of the channel list
+// The channel type, PTC and program number must be set; the list type and
+// satellite ID are those of the channel list.
+func (a *MainTVAgent) SetChannel(ch TVChannel, listType, satelliteID string) error {
+	minor := ch.Minor
+	if minor <= 0 {
+		minor = noMinorChannel
+	}
+	c, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"Channel"`
+		Type    string   `xml:"ChType"`
+		Major   int      `xml:"MajorCh"`
+		Minor   int      `xml:"MinorCh"`
+		PTC     int      `xml:"PTC"`
+		ProgNum int      `xml:"ProgNum"`
+	}{Type: ch.Type, Major: ch.Major, Minor: minor, PTC: ch.PTC, ProgNum: ch.ProgNum})
+	if err != nil {
+		return err
+	}
+	_, err = a.call("SetMainTVChannel",
+		soapArg{"ChannelListType", listType},
+		soapArg{"SatelliteID", satelliteID},
+		soapArg{"Channel", xml.Header + string(c)})
+	return err
+}
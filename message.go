@@ -76,7 +76,8 @@ func (s *SmartViewSession) parseSmartMessage(msg string) (string, error) {
 
 	r, err := s.aesDecrypt(cipherdata)
 	if err != nil {
-		return "", errors.Wrap(err, "cannot decrypt response")
+		// The TV does not use the same session key
+		return "", errors.Wrapf(ErrInvalidCredentials, "cannot decrypt response: %v", err)
 	}
 	logrus.Debug("Successfully decrypted response: ", r)
 	return string(r), nil
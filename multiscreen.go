@@ -0,0 +1,320 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Special message targets
+const (
+	MultiScreenHost      = "host"      // The TV application
+	MultiScreenAll       = "all"       // All the clients, including the sender
+	MultiScreenBroadcast = "broadcast" // All the clients, except the sender
+)
+
+// MultiScreen channel events related to the clients
+const (
+	MultiScreenClientConnect    = "ms.channel.clientConnect"
+	MultiScreenClientDisconnect = "ms.channel.clientDisconnect"
+)
+
+const multiScreenChannelsPath = "/api/v2/channels/"
+
+// multiScreenEventBuffer is the number of received events kept until
+// they are read
+const multiScreenEventBuffer = 64
+
+// MultiScreenClient is a client connected to a MultiScreen channel
+type MultiScreenClient struct {
+	ID          string                 `json:"id"`
+	IsHost      bool                   `json:"isHost"`
+	ConnectTime int64                  `json:"connectTime"`
+	Attributes  map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// MultiScreenEvent is an event received on a MultiScreen channel
+// For the client events (MultiScreenClientConnect and
+// MultiScreenClientDisconnect), Client contains the client information.
+type MultiScreenEvent struct {
+	Event  string             `json:"event"`
+	From   string             `json:"from,omitempty"`
+	Data   json.RawMessage    `json:"data,omitempty"`
+	Client *MultiScreenClient `json:"-"`
+}
+
+// MultiScreenChannelOptions contains the settings used to open a
+// MultiScreen channel
+type MultiScreenChannelOptions struct {
+	Address string // TV IP address
+	Ports   Ports  // Service ports (zero values for the defaults)
+	Name    string // Client name displayed by the TV
+	Token   string // Access token (secure service)
+}
+
+// MultiScreenChannel is a connection to a MultiScreen channel, used to exchange
+// messages with a TV application
+type MultiScreenChannel struct {
+	id     string // Channel identifier
+	conn   *websocket.Conn
+	events chan MultiScreenEvent
+
+	mux      sync.Mutex
+	clientID string
+	clients  []MultiScreenClient
+	err      error
+	closed   bool
+}
+
+// multiScreenMessage is a message exchanged on a MultiScreen channel
+type multiScreenMessage struct {
+	Event  string          `json:"event,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params interface{}     `json:"params,omitempty"`
+	From   string          `json:"from,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// OpenMultiScreenChannel connects to a MultiScreen channel of the TV
+// The channel identifier is defined by the TV application.
+func OpenMultiScreenChannel(channelID string, opts MultiScreenChannelOptions) (*MultiScreenChannel, error) {
+	if opts.Address == "" {
+		return nil, errors.New("empty TV IP address")
+	}
+	if channelID == "" || strings.ContainsAny(channelID, "/?#") {
+		return nil, errors.New("invalid channel identifier")
+	}
+	name := opts.Name
+	if name == "" {
+		name = defaultAppID
+	}
+
+	q := url.Values{}
+	q.Set("name", base64.StdEncoding.EncodeToString([]byte(name)))
+	if opts.Token != "" {
+		q.Set("token", opts.Token)
+	}
+	conn, err := dialMultiScreen(opts.Address, DefaultPorts.Merge(opts.Ports), multiScreenChannelsPath+channelID, q)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &MultiScreenChannel{
+		id:     channelID,
+		conn:   conn,
+		events: make(chan MultiScreenEvent, multiScreenEventBuffer),
+	}
+	ready := make(chan error, 1)
+	go c.readMessages(ready)
+
+	select {
+	case err = <-ready:
+	case <-time.After(handshakeTimeout):
+		err = errors.New("timeout waiting for the channel connection")
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// ID returns the channel identifier
+func (c *MultiScreenChannel) ID() string {
+	return c.id
+}
+
+// ClientID returns the identifier of this client on the channel
+func (c *MultiScreenChannel) ClientID() string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.clientID
+}
+
+// Clients returns the clients connected to the channel
+func (c *MultiScreenChannel) Clients() []MultiScreenClient {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return append([]MultiScreenClient(nil), c.clients...)
+}
+
+// Events returns the stream of received events
+// The channel is closed when the connection is terminated; Err returns
+// the reason.  Up to 64 events are buffered: the events received while
+// the buffer is full are dropped, so the stream should be read
+// continuously.
+func (c *MultiScreenChannel) Events() <-chan MultiScreenEvent {
+	return c.events
+}
+
+// Err returns the error that terminated the connection, if any
+func (c *MultiScreenChannel) Err() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.err
+}
+
+// Send sends an event to a client of the channel
+// The target is a client identifier or one of MultiScreenHost, MultiScreenAll and
+// MultiScreenBroadcast.  The data is encoded as JSON (a json.RawMessage is sent
+// as is).
+func (c *MultiScreenChannel) Send(event string, data interface{}, to string) error {
+	if event == "" {
+		return errors.New("empty event name")
+	}
+	if to == "" {
+		to = MultiScreenHost
+	}
+	params := map[string]interface{}{
+		"event": event,
+		"to":    to,
+	}
+	if data != nil {
+		params["data"] = data
+	}
+	m, err := json.Marshal(multiScreenMessage{Method: "ms.channel.emit", Params: params})
+	if err != nil {
+		return errors.Wrap(err, "cannot encode event")
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.closed {
+		return errors.New("channel closed")
+	}
+	logrus.Debugf("Sending channel message: `%s`", m)
+	c.conn.SetWriteDeadline(time.Now().Add(15 * time.Second))
+	return c.conn.WriteMessage(websocket.TextMessage, m)
+}
+
+// Broadcast sends an event to all the other clients of the channel
+func (c *MultiScreenChannel) Broadcast(event string, data interface{}) error {
+	return c.Send(event, data, MultiScreenBroadcast)
+}
+
+// Close terminates the connection
+func (c *MultiScreenChannel) Close() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	c.conn.Close()
+}
+
+// readMessages handles the messages received from the TV
+// The connection result is sent to the ready channel.
+func (c *MultiScreenChannel) readMessages(ready chan<- error) {
+	defer close(c.events)
+
+	connected := false
+	for {
+		_, p, err := c.conn.ReadMessage()
+		if err != nil {
+			c.mux.Lock()
+			if !c.closed {
+				c.err = errors.Wrap(err, "connection closed")
+				logrus.Debug("Channel read failed: ", err)
+			}
+			c.mux.Unlock()
+			if !connected {
+				ready <- errors.Wrap(err, "connection closed")
+			}
+			return
+		}
+		logrus.Debugf("Channel message: `%s`", p)
+
+		var msg multiScreenMessage
+		if err := json.Unmarshal(p, &msg); err != nil {
+			logrus.Info("Could not parse channel message: ", err)
+			continue
+		}
+
+		switch msg.Event {
+		case "ms.channel.connect":
+			var data struct {
+				ID      string              `json:"id"`
+				Clients []MultiScreenClient `json:"clients"`
+			}
+			json.Unmarshal(msg.Data, &data)
+			c.mux.Lock()
+			c.clientID, c.clients = data.ID, data.Clients
+			c.mux.Unlock()
+			if !connected {
+				connected = true
+				ready <- nil
+			}
+			continue
+		case "ms.channel.unauthorized":
+			if !connected {
+				connected = true
+				ready <- ErrAccessDenied
+			}
+			continue
+		case "ms.channel.ready":
+			continue
+		}
+
+		ev := MultiScreenEvent{Event: msg.Event, From: msg.From, Data: msg.Data}
+		switch msg.Event {
+		case MultiScreenClientConnect, MultiScreenClientDisconnect:
+			var client MultiScreenClient
+			if err := json.Unmarshal(msg.Data, &client); err != nil {
+				logrus.Info("Could not parse client information: ", err)
+				continue
+			}
+			ev.Client = &client
+			c.updateClients(msg.Event, client)
+		}
+
+		select {
+		case c.events <- ev:
+		default:
+			logrus.Info("Channel event dropped: ", msg.Event)
+		}
+	}
+}
+
+// updateClients updates the client list
+func (c *MultiScreenChannel) updateClients(event string, client MultiScreenClient) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for i, cl := range c.clients {
+		if cl.ID == client.ID {
+			c.clients = append(c.clients[:i], c.clients[i+1:]...)
+			break
+		}
+	}
+	if event == MultiScreenClientConnect {
+		c.clients = append(c.clients, client)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/McKael/samtv"
+	"github.com/McKael/samtv/samtvtest"
+)
+
+const testChannelID = "com.example.test"
+
+// openTestChannel connects a client to a MultiScreen channel of the fake TV
+func openTestChannel(t *testing.T, srv *samtvtest.Server, name string) *samtv.MultiScreenChannel {
+	t.Helper()
+	ports := srv.Ports()
+	// No secure service: the plain connection is used
+	ports.SecureRemote = ports.Description
+	c, err := samtv.OpenMultiScreenChannel(testChannelID, samtv.MultiScreenChannelOptions{
+		Address: srv.Address(),
+		Ports:   ports,
+		Name:    name,
+	})
+	if err != nil {
+		t.Fatal("cannot open channel: ", err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+// nextEvent returns the next event received on a channel
+func nextEvent(t *testing.T, c *samtv.MultiScreenChannel) samtv.MultiScreenEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-c.Events():
+		if !ok {
+			t.Fatal("channel closed: ", c.Err())
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for a channel event")
+	}
+	return samtv.MultiScreenEvent{}
+}
+
+func TestMultiScreenChannel(t *testing.T) {
+	srv := newTestServer(t)
+
+	c1 := openTestChannel(t, srv, "first")
+	if c1.ID() != testChannelID || c1.ClientID() == "" {
+		t.Fatalf("unexpected channel/client IDs: %q, %q", c1.ID(), c1.ClientID())
+	}
+	if n := len(c1.Clients()); n != 2 {
+		t.Errorf("got %d clients, want 2 (host and client)", n)
+	}
+
+	c2 := openTestChannel(t, srv, "second")
+	if n := len(c2.Clients()); n != 3 {
+		t.Errorf("got %d clients, want 3", n)
+	}
+
+	// The first client is notified of the new client
+	ev := nextEvent(t, c1)
+	if ev.Event != samtv.MultiScreenClientConnect || ev.Client == nil || ev.Client.ID != c2.ClientID() {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	if name := ev.Client.Attributes["name"]; name != "second" {
+		t.Errorf("client name is %v, want second", name)
+	}
+	if n := len(c1.Clients()); n != 3 {
+		t.Errorf("got %d clients after connection, want 3", n)
+	}
+
+	// Broadcast between the clients
+	if err := c2.Broadcast("say", map[string]string{"text": "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	ev = nextEvent(t, c1)
+	var data struct{ Text string }
+	if err := json.Unmarshal(ev.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Event != "say" || ev.From != c2.ClientID() || data.Text != "hello" {
+		t.Errorf("unexpected event %+v", ev)
+	}
+
+	// Events sent to the TV application
+	if err := c1.Send("ping", json.RawMessage(`42`), samtv.MultiScreenHost); err != nil {
+		t.Fatal(err)
+	}
+	// The client receives its own message when sent to all the clients
+	if err := c1.Send("sync", nil, samtv.MultiScreenAll); err != nil {
+		t.Fatal(err)
+	}
+	if ev := nextEvent(t, c1); ev.Event != "sync" || ev.From != c1.ClientID() {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	if ev := nextEvent(t, c2); ev.Event != "sync" {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	hostEvents := srv.HostEvents(testChannelID)
+	if len(hostEvents) != 3 {
+		t.Fatalf("host received %d events, want 3", len(hostEvents))
+	}
+	if ev := hostEvents[1]; ev.Event != "ping" || ev.From != c1.ClientID() || string(ev.Data) != "42" {
+		t.Errorf("unexpected host event %+v", ev)
+	}
+
+	// Events sent by the TV application
+	if err := srv.SendHostEvent(testChannelID, "state", "playing", c2.ClientID()); err != nil {
+		t.Fatal(err)
+	}
+	if ev := nextEvent(t, c2); ev.Event != "state" || ev.From != samtv.MultiScreenHost || string(ev.Data) != `"playing"` {
+		t.Errorf("unexpected event %+v", ev)
+	}
+
+	// Disconnection
+	c2.Close()
+	ev = nextEvent(t, c1)
+	if ev.Event != samtv.MultiScreenClientDisconnect || ev.Client == nil || ev.Client.ID != c2.ClientID() {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	if n := len(c1.Clients()); n != 2 {
+		t.Errorf("got %d clients after disconnection, want 2", n)
+	}
+	if err := c2.Send("late", nil, ""); err == nil {
+		t.Error("Send succeeded on a closed channel")
+	}
+}
+
+func TestMultiScreenChannelClosed(t *testing.T) {
+	srv := newTestServer(t)
+	c := openTestChannel(t, srv, "client")
+
+	srv.Close()
+	select {
+	case _, ok := <-c.Events():
+		if ok {
+			t.Fatal("unexpected event")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event stream was not closed")
+	}
+	if c.Err() == nil {
+		t.Error("no error after the connection was closed")
+	}
+}
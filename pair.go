@@ -24,12 +24,11 @@ import (
 	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"regexp"
 	"strconv"
-	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -73,9 +72,9 @@ func (s *SmartViewSession) Pair(pin int) (string, int, string, error) {
 }
 
 func (s *SmartViewSession) getTVPairingStepURL(step int) string {
-	const appID = "samtvcli"
-	return "http://" + s.tvAddress + ":8080/ws/pairing?step=" + strconv.Itoa(step) +
-		"&app_id=" + appID + "&device_id=" + s.uuid + "&type=1"
+	return "http://" + s.serviceAddress(s.ports.Pairing) + "/ws/pairing?step=" + strconv.Itoa(step) +
+		"&app_id=" + url.QueryEscape(s.appID) +
+		"&device_id=" + url.QueryEscape(s.uuid) + "&type=1"
 }
 
 func (s *SmartViewSession) startPairing() error {
@@ -109,7 +108,7 @@ func (s *SmartViewSession) startPairing() error {
 }
 
 func (s *SmartViewSession) openPINPage() error {
-	pinPageURL := "http://" + s.tvAddress + ":8080/ws/apps/CloudPINPage"
+	pinPageURL := "http://" + s.serviceAddress(s.ports.Pairing) + "/ws/apps/CloudPINPage"
 	resp, err := http.PostForm(pinPageURL, url.Values{"data": {"pin4"}})
 	if err != nil {
 		return errors.Wrap(err, "could not request popup")
@@ -127,7 +126,7 @@ func (s *SmartViewSession) openPINPage() error {
 }
 
 func (s *SmartViewSession) closePINPage() error {
-	pinClosePageURL := "http://" + s.tvAddress + ":8080/ws/apps/CloudPINPage/run"
+	pinClosePageURL := "http://" + s.serviceAddress(s.ports.Pairing) + "/ws/apps/CloudPINPage/run"
 	client := &http.Client{}
 	req, err := http.NewRequest("DELETE", pinClosePageURL, nil)
 	if err != nil {
@@ -141,29 +140,39 @@ func (s *SmartViewSession) closePINPage() error {
 	return nil
 }
 
+// PINPageState returns the state of the TV PIN page application
+// ("running" or "stopped").
+func (s *SmartViewSession) PINPageState() (string, error) {
+	if s == nil || s.tvAddress == "" {
+		return "", errors.New("SmartViewSession not initialized")
+	}
+	return s.checkPINPage()
+}
+
 func (s *SmartViewSession) checkPINPage() (string, error) {
-	pinPageURL := "http://" + s.tvAddress + ":8080/ws/apps/CloudPINPage"
+	pinPageURL := "http://" + s.serviceAddress(s.ports.Pairing) + "/ws/apps/CloudPINPage"
 	resp, err := http.Get(pinPageURL)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return "", errors.Wrap(err, "could not read device response")
 	}
-	body := string(bodyBytes)
+
+	var info dialServiceInfo
+	if err := xml.Unmarshal(body, &info); err != nil {
+		return "", errors.Wrap(err, "could not parse device response")
+	}
 	// Basic check
-	if !strings.Contains(body, "<name>CloudPINPage</name>") {
+	if info.Name != "CloudPINPage" {
 		return "", errors.New("unexpected response contents")
 	}
-	// Get status
-	statusRe := regexp.MustCompile("<state>([^<]+)</state>")
-	m := statusRe.FindStringSubmatch(body)
-	if len(m) < 2 {
-		return "", errors.Wrap(err, "could not parse device response")
+	if info.State == "" {
+		return "", errors.New("could not get PIN page state")
 	}
-	return m[1], nil
+	return info.State, nil
 }
 
 func (s *SmartViewSession) postTVPairingStep(step int, data []byte) (string, error) {
@@ -192,10 +201,8 @@ func (s *SmartViewSession) postTVPairingStep(step int, data []byte) (string, err
 }
 
 func (s *SmartViewSession) pairingSteps(pin int) error {
-	const userID = "654321"
-
 	handshake := smartcrypto.HelloData{
-		UserID: userID,
+		UserID: s.userID,
 		PIN:    strconv.Itoa(pin),
 	}
 
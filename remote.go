@@ -0,0 +1,42 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv
+
+// Remote is the interface of a SmartView remote control session
+// It extends Backend with the SmartView specific methods (PIN page,
+// two-step pairing, credentials check).  It is implemented by
+// SmartViewSession; it can be used to replace the session with a mock (see
+// the samtvmock package) in unit tests.
+type Remote interface {
+	Backend
+
+	// InitSession opens the connection to the TV
+	InitSession() error
+	// Ping checks the TV accepts the session credentials
+	Ping() error
+	// Pair handles a pairing step (see SmartViewSession.Pair)
+	Pair(pin int) (string, int, string, error)
+	// PINPageState returns the state of the TV PIN page
+	PINPageState() (string, error)
+}
+
+// SmartViewSession implements the Remote interface
+var _ Remote = (*SmartViewSession)(nil)
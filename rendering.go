@@ -0,0 +1,93 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RenderingControlService is the UPnP RenderingControl service type
+const RenderingControlService = "urn:schemas-upnp-org:service:RenderingControl:1"
+
+// RenderingControl is a client of the TV UPnP RenderingControl service,
+// used to read and set the volume and mute state
+type RenderingControl struct {
+	svc *upnpService
+}
+
+// NewRenderingControl finds the RenderingControl service of the TV
+// The service is discovered with SSDP; if the TV does not answer, the
+// media renderer description on the MediaRenderer port is used.
+func NewRenderingControl(tvAddress string, ports Ports) (*RenderingControl, error) {
+	svc, err := findMediaRendererService(tvAddress, ports, RenderingControlService)
+	if err != nil {
+		return nil, err
+	}
+	return &RenderingControl{svc: svc}, nil
+}
+
+var masterChannel = []soapArg{{"InstanceID", "0"}, {"Channel", "Master"}}
+
+// GetVolume returns the current volume
+func (r *RenderingControl) GetVolume() (int, error) {
+	out, err := r.svc.call("GetVolume", masterChannel...)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(out["CurrentVolume"]))
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid volume value")
+	}
+	return v, nil
+}
+
+// SetVolume sets the volume
+func (r *RenderingControl) SetVolume(volume int) error {
+	if volume < 0 {
+		return errors.New("invalid volume value")
+	}
+	_, err := r.svc.call("SetVolume", append(masterChannel,
+		soapArg{"DesiredVolume", strconv.Itoa(volume)})...)
+	return err
+}
+
+// GetMute returns true if the sound is muted
+func (r *RenderingControl) GetMute() (bool, error) {
+	out, err := r.svc.call("GetMute", masterChannel...)
+	if err != nil {
+		return false, err
+	}
+	return parseUPnPBool(out["CurrentMute"]), nil
+}
+
+// SetMute mutes or unmutes the sound
+func (r *RenderingControl) SetMute(mute bool) error {
+	v := "0"
+	if mute {
+		v = "1"
+	}
+	_, err := r.svc.call("SetMute", append(masterChannel,
+		soapArg{"DesiredMute", v})...)
+	return err
+}
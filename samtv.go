@@ -23,6 +23,7 @@ package samtv
 import (
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -35,13 +36,20 @@ import (
 // SmartViewSession contains data for a Smart View session
 type SmartViewSession struct {
 	tvAddress  string // TV network IP:port
+	ports      Ports  // TV service ports
 	uuid       string // Device Identifier
 	sessionKey []byte // Session encryption key
 	sessionID  int    // Session ID
+	appID      string // Application identifier used for pairing
+	userID     string // User identifier used for pairing
+
+	pinProvider        PINProvider            // Used for in-band pairing
+	credentialsChanged CredentialsChangedFunc // Called after pairing
 
 	ws struct {
 		c    *websocket.Conn // Websocket Connection
 		read chan string     // Websocket message reader
+		errs chan error      // Websocket errors
 		//write chan string     // Websocket message writer
 		state int
 		mux   sync.Mutex
@@ -56,26 +64,74 @@ const (
 	stateConnected
 )
 
-const defaultSessionUUID = "samtv"
+// Timeouts
+const handshakeTimeout = 15 * time.Second
 
-// NewSmartViewSession initializes en new SmartViewSession
-func NewSmartViewSession(tvAddress string) (*SmartViewSession, error) {
+var replyTimeout = 5 * time.Second
+
+// Ports contains the TCP ports of the TV services
+type Ports struct {
+	SocketIO    int // SmartView socket.io service
+	Description int // Device description service
+	Pairing     int // Pairing and DIAL applications service
+
+	SecureRemote int // Tizen secure remote control service
+	Legacy       int // Legacy remote control service (pre-2014 models)
+
+	MediaRenderer int // UPnP media renderer service
+	MainTV        int // UPnP MainTVAgent2 service
+}
 
+// DefaultPorts are the default service ports of the TV models
+var DefaultPorts = Ports{
+	SocketIO:    8000,
+	Description: 8001,
+	Pairing:     8080,
+
+	SecureRemote: 8002,
+	Legacy:       55000,
+
+	MediaRenderer: 9197,
+	MainTV:        7676,
+}
+
+// Default pairing identity
+const (
+	defaultSessionUUID = "samtv"
+	defaultAppID       = "samtvcli"
+	defaultUserID      = "654321"
+)
+
+// checkTVAddress checks the TV address given to the session constructors
+// The address should be a host name or IP address, without port.
+func checkTVAddress(tvAddress string) error {
 	if tvAddress == "" {
-		return nil, errors.New("empty TV IP address")
+		return errors.New("empty TV IP address")
 	}
 
 	// Basic check
 	if strings.ContainsRune(tvAddress, ':') {
-		return nil, errors.New("the address should not contain a semicolon")
+		return errors.New("the address should not contain a semicolon")
+	}
+	return nil
+}
+
+// NewSmartViewSession initializes en new SmartViewSession
+func NewSmartViewSession(tvAddress string) (*SmartViewSession, error) {
+	if err := checkTVAddress(tvAddress); err != nil {
+		return nil, err
 	}
 
 	svs := SmartViewSession{
 		tvAddress: tvAddress,
+		ports:     DefaultPorts,
 		uuid:      defaultSessionUUID,
+		appID:     defaultAppID,
+		userID:    defaultUserID,
 	}
 
 	svs.ws.read = make(chan string, 16)
+	svs.ws.errs = make(chan error, 4)
 
 	return &svs, nil
 }
@@ -95,6 +151,53 @@ func (s *SmartViewSession) RestoreSessionData(sessionKey []byte, sessionID int,
 	}
 }
 
+// SetPorts sets the TV service ports.  Zero values are ignored.
+func (s *SmartViewSession) SetPorts(p Ports) {
+	s.ports = s.ports.Merge(p)
+}
+
+// Merge returns the ports overridden by the non-zero values of o
+func (p Ports) Merge(o Ports) Ports {
+	if o.SocketIO > 0 {
+		p.SocketIO = o.SocketIO
+	}
+	if o.Description > 0 {
+		p.Description = o.Description
+	}
+	if o.Pairing > 0 {
+		p.Pairing = o.Pairing
+	}
+	if o.SecureRemote > 0 {
+		p.SecureRemote = o.SecureRemote
+	}
+	if o.Legacy > 0 {
+		p.Legacy = o.Legacy
+	}
+	if o.MediaRenderer > 0 {
+		p.MediaRenderer = o.MediaRenderer
+	}
+	if o.MainTV > 0 {
+		p.MainTV = o.MainTV
+	}
+	return p
+}
+
+// serviceAddress returns the host:port address of a TV service
+func (s *SmartViewSession) serviceAddress(port int) string {
+	return s.tvAddress + ":" + strconv.Itoa(port)
+}
+
+// SetPairingIdentity sets the application and user identifiers used for
+// pairing.  Empty values are ignored.
+func (s *SmartViewSession) SetPairingIdentity(appID, userID string) {
+	if appID != "" {
+		s.appID = appID
+	}
+	if userID != "" {
+		s.userID = userID
+	}
+}
+
 // InitSession initiates a websocket connection for the SmartViewSession
 func (s *SmartViewSession) InitSession() error {
 	if s.tvAddress == "" {
@@ -115,11 +218,21 @@ func (s *SmartViewSession) InitSession() error {
 		return errors.Wrap(err, "cannot initiate connection")
 	}
 
-	<-s.ws.read // Wait for connection
+	// Wait for the SmartView handshake
+	if err := s.waitHandshake(); err != nil {
+		s.Close()
+		return err
+	}
 
 	// We need to pair with the TV if we don't have a session yet
 	if len(s.sessionKey) != 16 || s.sessionID <= 0 {
 		// No previous session; we need to pair with the Smart TV
+		if s.pinProvider != nil {
+			if _, err := s.PairWith(s.pinProvider); err != nil {
+				return errors.Wrap(err, "pairing failed")
+			}
+			return nil
+		}
 		if _, _, _, err := s.Pair(0); err != nil {
 			return errors.Wrap(err, "pairing failed")
 		}
@@ -130,6 +243,30 @@ func (s *SmartViewSession) InitSession() error {
 	return nil
 }
 
+// waitHandshake waits until the SmartView handshake is completed
+func (s *SmartViewSession) waitHandshake() error {
+	select {
+	case <-s.ws.read:
+		return nil
+	case err := <-s.ws.errs:
+		return errors.Wrap(err, "handshake failed")
+	case <-time.After(handshakeTimeout):
+		return errors.New("handshake timeout")
+	}
+}
+
+// getReply waits for the reply to a request sent to the device
+func (s *SmartViewSession) getReply() (string, error) {
+	select {
+	case msg := <-s.ws.read:
+		return msg, nil
+	case err := <-s.ws.errs:
+		return "", err
+	case <-time.After(replyTimeout):
+		return "", errors.New("no reply from TV")
+	}
+}
+
 // GetMessage returns the next message received from the device
 // If block is true, the read will block for 5 seconds.
 func (s *SmartViewSession) GetMessage(block bool) string {
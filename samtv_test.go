@@ -0,0 +1,281 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/McKael/samtv"
+	"github.com/McKael/samtv/samtvtest"
+)
+
+const testPIN = 1234
+
+// newTestServer starts a fake TV stopped at the end of the test
+func newTestServer(t *testing.T) *samtvtest.Server {
+	t.Helper()
+	srv, err := samtvtest.NewServer(samtvtest.Config{PIN: "1234"})
+	if err != nil {
+		t.Fatal("cannot start fake TV: ", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+// newPairedSession returns a session using credentials registered in the
+// fake TV
+func newPairedSession(t *testing.T, srv *samtvtest.Server) *samtv.SmartViewSession {
+	t.Helper()
+	c, err := srv.AddSession("test-device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := srv.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetCredentials(c); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestPairing(t *testing.T) {
+	srv := newTestServer(t)
+	s, err := srv.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, _, _, err := s.Pair(0); err != nil {
+		t.Fatal("cannot open the PIN page: ", err)
+	}
+	if !srv.PINPageRunning() {
+		t.Fatal("the PIN page is not displayed")
+	}
+	if _, _, _, err := s.Pair(testPIN + 1); err == nil {
+		t.Error("pairing succeeded with a wrong PIN code")
+	}
+	_, id, key, err := s.Pair(testPIN)
+	if err != nil {
+		t.Fatal("pairing failed: ", err)
+	}
+	if id <= 0 || len(key) != 32 {
+		t.Errorf("invalid session: id %d, key %q", id, key)
+	}
+	if srv.PINPageRunning() {
+		t.Error("the PIN page has not been closed")
+	}
+
+	// The new session can be used
+	if err := s.Key("KEY_VOLUP"); err != nil {
+		t.Fatal("cannot send key after pairing: ", err)
+	}
+	if keys := srv.Keys(); len(keys) != 1 || keys[0] != "KEY_VOLUP" {
+		t.Errorf("received keys %v, want [KEY_VOLUP]", keys)
+	}
+}
+
+func TestPairWith(t *testing.T) {
+	srv := newTestServer(t)
+	s, err := srv.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var changed samtv.Credentials
+	s.SetCredentialsChangedFunc(func(c samtv.Credentials) { changed = c })
+
+	// The first PIN code is wrong
+	pins := []int{testPIN + 1, testPIN}
+	c, err := s.PairWith(samtv.PINProviderFunc(func(attempt int) (int, error) {
+		return pins[attempt-1], nil
+	}))
+	if err != nil {
+		t.Fatal("pairing failed: ", err)
+	}
+	if c.SessionKey == "" || c.SessionID <= 0 {
+		t.Errorf("incomplete credentials: %+v", c)
+	}
+	if changed != c {
+		t.Errorf("credentials changed function called with %+v, want %+v", changed, c)
+	}
+}
+
+func TestKeyAndPing(t *testing.T) {
+	srv := newTestServer(t)
+	s := newPairedSession(t, srv)
+
+	for _, k := range []string{"KEY_MUTE", "KEY_CHUP"} {
+		if err := s.Key(k); err != nil {
+			t.Fatalf("cannot send %s: %v", k, err)
+		}
+	}
+	if err := s.Ping(); err != nil {
+		t.Fatal("ping failed: ", err)
+	}
+
+	// The ping request must not be handled as a key
+	keys := srv.Keys()
+	if strings.Join(keys, " ") != "KEY_MUTE KEY_CHUP" {
+		t.Errorf("received keys %v, want [KEY_MUTE KEY_CHUP]", keys)
+	}
+}
+
+func TestPingRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		faults samtvtest.Faults
+	}{
+		{"bad padding", samtvtest.Faults{BadPadding: true}},
+		{"unauthorized", samtvtest.Faults{Unauthorized: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			s := newPairedSession(t, srv)
+			srv.SetFaults(tt.faults)
+
+			err := s.Ping()
+			if err == nil {
+				t.Fatal("ping succeeded with rejected credentials")
+			}
+			if !samtv.IsInvalidCredentials(err) {
+				t.Errorf("error %q is not reported as invalid credentials", err)
+			}
+		})
+	}
+}
+
+func TestInvalidCredentials(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(*samtvtest.Server)
+		invalid bool // The error means the credentials are invalid
+	}{
+		{"bad padding", func(srv *samtvtest.Server) {
+			srv.SetFaults(samtvtest.Faults{BadPadding: true})
+		}, true},
+		{"unauthorized", func(srv *samtvtest.Server) {
+			srv.SetFaults(samtvtest.Faults{Unauthorized: true})
+		}, true},
+		// The socket.io error messages are not related to the credentials
+		{"reset sessions", func(srv *samtvtest.Server) {
+			srv.ResetSessions()
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			s := newPairedSession(t, srv)
+			tt.setup(srv)
+
+			err := s.Key("KEY_MUTE")
+			if err == nil {
+				t.Fatal("key sent with rejected credentials")
+			}
+			if samtv.IsInvalidCredentials(err) != tt.invalid {
+				t.Errorf("error %q: invalid credentials = %v, want %v",
+					err, samtv.IsInvalidCredentials(err), tt.invalid)
+			}
+		})
+	}
+}
+
+func TestReplyTimeout(t *testing.T) {
+	defer samtv.SetReplyTimeout(200 * time.Millisecond)()
+
+	srv := newTestServer(t)
+	s := newPairedSession(t, srv)
+	srv.SetFaults(samtvtest.Faults{DropReplies: true})
+
+	start := time.Now()
+	err := s.Key("KEY_MUTE")
+	if err == nil {
+		t.Fatal("no error without a reply from the TV")
+	}
+	if samtv.IsInvalidCredentials(err) {
+		t.Errorf("timeout reported as invalid credentials: %v", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("the request returned after %v", d)
+	}
+}
+
+func TestReplyLatency(t *testing.T) {
+	defer samtv.SetReplyTimeout(time.Second)()
+
+	srv := newTestServer(t)
+	s := newPairedSession(t, srv)
+
+	// Slow reply, within the timeout
+	srv.SetFaults(samtvtest.Faults{Latency: 200 * time.Millisecond})
+	start := time.Now()
+	if err := s.Key("KEY_VOLUP"); err != nil {
+		t.Fatal("slow reply rejected: ", err)
+	}
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Errorf("the request returned after %v, before the reply", d)
+	}
+
+	// Reply after the timeout
+	srv.SetFaults(samtvtest.Faults{Latency: 2 * time.Second})
+	err := s.Key("KEY_VOLDOWN")
+	if err == nil {
+		t.Fatal("no error with a late reply")
+	}
+	if samtv.IsInvalidCredentials(err) {
+		t.Errorf("timeout reported as invalid credentials: %v", err)
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	srv := newTestServer(t)
+	s := newPairedSession(t, srv)
+
+	srv.SetFaults(samtvtest.Faults{Disconnect: true})
+	err := s.Key("KEY_MUTE")
+	if err == nil {
+		t.Fatal("no error when the TV closes the connection")
+	}
+	if samtv.IsInvalidCredentials(err) {
+		t.Errorf("disconnection reported as invalid credentials: %v", err)
+	}
+
+	// The session connects again after the TV has closed the connection
+	srv.SetFaults(samtvtest.Faults{})
+	if err := s.Key("KEY_MUTE"); err != nil {
+		t.Fatal("no new connection after a disconnection: ", err)
+	}
+	srv.Disconnect()
+	time.Sleep(100 * time.Millisecond)
+	if err := s.Key("KEY_VOLUP"); err != nil {
+		t.Fatal("no new connection after a disconnection: ", err)
+	}
+	if keys := srv.Keys(); len(keys) != 2 || keys[1] != "KEY_VOLUP" {
+		t.Errorf("the TV received %v", keys)
+	}
+}
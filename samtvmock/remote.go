@@ -0,0 +1,350 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package samtvmock provides an in-memory implementation of the
+// samtv.Remote and samtv.Backend interfaces for unit tests.
+//
+// The mock Remote records the method calls, can return scripted errors
+// and can check the calls against an expected sequence.
+package samtvmock
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/McKael/samtv"
+)
+
+// Call is a recorded method call
+type Call struct {
+	Method string
+	Args   []interface{}
+	Err    error // Returned error
+}
+
+// String returns the call as "Method(arg1, arg2)"
+func (c Call) String() string {
+	args := make([]string, len(c.Args))
+	for i, a := range c.Args {
+		args[i] = fmt.Sprint(a)
+	}
+	return c.Method + "(" + strings.Join(args, ", ") + ")"
+}
+
+// TestingT is the subset of testing.TB used by the assertions
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Remote is a mock samtv.Remote
+type Remote struct {
+	mux         sync.Mutex
+	calls       []Call
+	queued      map[string][]error // Scripted errors, used once
+	errs        map[string]error   // Scripted errors, used until cleared
+	connected   bool
+	pinPage     bool
+	credentials samtv.Credentials
+	description samtv.SmartDeviceDescription
+}
+
+// Name is the backend name of the mock
+const Name = "mock"
+
+// Remote implements the samtv.Remote and samtv.Backend interfaces
+var _ samtv.Remote = (*Remote)(nil)
+var _ samtv.Backend = (*Remote)(nil)
+
+// New returns a new mock Remote with the given credentials
+func New(c samtv.Credentials) *Remote {
+	return &Remote{
+		queued:      make(map[string][]error),
+		errs:        make(map[string]error),
+		credentials: c,
+		description: samtv.SmartDeviceDescription{
+			DUID:      "uuid:00000000-0000-0000-0000-000000000000",
+			ModelName: "UE40H6400",
+		},
+	}
+}
+
+// SetDescription sets the value returned by DeviceDescription
+func (m *Remote) SetDescription(d samtv.SmartDeviceDescription) {
+	m.mux.Lock()
+	m.description = d
+	m.mux.Unlock()
+}
+
+// QueueError adds errors returned by the next calls of the method
+// A nil error means the call succeeds.
+func (m *Remote) QueueError(method string, errs ...error) {
+	m.mux.Lock()
+	m.queued[method] = append(m.queued[method], errs...)
+	m.mux.Unlock()
+}
+
+// SetError sets the error returned by all the calls of the method, once the
+// queued errors have been used.  A nil error clears it.
+func (m *Remote) SetError(method string, err error) {
+	m.mux.Lock()
+	if err == nil {
+		delete(m.errs, method)
+	} else {
+		m.errs[method] = err
+	}
+	m.mux.Unlock()
+}
+
+// Calls returns the recorded calls
+func (m *Remote) Calls() []Call {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// Keys returns the keys sent with successful Key calls
+func (m *Remote) Keys() []string {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	var keys []string
+	for _, c := range m.calls {
+		if c.Method == "Key" && c.Err == nil {
+			keys = append(keys, c.Args[0].(string))
+		}
+	}
+	return keys
+}
+
+// Reset clears the recorded calls and the scripted errors
+func (m *Remote) Reset() {
+	m.mux.Lock()
+	m.calls = nil
+	m.queued = make(map[string][]error)
+	m.errs = make(map[string]error)
+	m.mux.Unlock()
+}
+
+// ExpectCalls checks the recorded calls, formatted like "Key(KEY_MUTE)",
+// match the expected sequence
+func (m *Remote) ExpectCalls(calls ...string) error {
+	var got []string
+	for _, c := range m.Calls() {
+		got = append(got, c.String())
+	}
+	return compare("calls", got, calls)
+}
+
+// ExpectKeys checks the keys successfully sent match the expected sequence
+func (m *Remote) ExpectKeys(keys ...string) error {
+	return compare("keys", m.Keys(), keys)
+}
+
+// AssertCalls reports an error to t if the calls do not match
+func (m *Remote) AssertCalls(t TestingT, calls ...string) {
+	t.Helper()
+	if err := m.ExpectCalls(calls...); err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+// AssertKeys reports an error to t if the keys do not match
+func (m *Remote) AssertKeys(t TestingT, keys ...string) {
+	t.Helper()
+	if err := m.ExpectKeys(keys...); err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+func compare(what string, got, want []string) error {
+	if len(got) == len(want) {
+		i := 0
+		for i < len(got) && got[i] == want[i] {
+			i++
+		}
+		if i == len(got) {
+			return nil
+		}
+	}
+	return errors.Errorf("unexpected %s:\n  got:  %v\n  want: %v", what, got, want)
+}
+
+// record registers a call and returns its scripted error
+func (m *Remote) record(method string, args ...interface{}) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	var err error
+	if q := m.queued[method]; len(q) > 0 {
+		err, m.queued[method] = q[0], q[1:]
+	} else {
+		err = m.errs[method]
+	}
+	m.calls = append(m.calls, Call{Method: method, Args: args, Err: err})
+	return err
+}
+
+// InitSession records the call and opens the mock connection
+func (m *Remote) InitSession() error {
+	if err := m.record("InitSession"); err != nil {
+		return err
+	}
+	m.mux.Lock()
+	m.connected = true
+	m.mux.Unlock()
+	return nil
+}
+
+// Name returns the mock backend name
+func (m *Remote) Name() string {
+	return Name
+}
+
+// Connect records the call and opens the mock connection
+func (m *Remote) Connect() error {
+	if err := m.record("Connect"); err != nil {
+		return err
+	}
+	m.mux.Lock()
+	m.connected = true
+	m.mux.Unlock()
+	return nil
+}
+
+// Close records the call and closes the mock connection
+func (m *Remote) Close() {
+	m.record("Close")
+	m.mux.Lock()
+	m.connected = false
+	m.mux.Unlock()
+}
+
+// Connected returns true if the mock connection is open
+func (m *Remote) Connected() bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.connected
+}
+
+// Key records the key
+func (m *Remote) Key(key string) error {
+	return m.record("Key", key)
+}
+
+// Ping records the call
+func (m *Remote) Ping() error {
+	return m.record("Ping")
+}
+
+// DeviceDescription records the call and returns the mock description
+func (m *Remote) DeviceDescription() (samtv.SmartDeviceDescription, error) {
+	if err := m.record("DeviceDescription"); err != nil {
+		return samtv.SmartDeviceDescription{}, err
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.description, nil
+}
+
+// Pair records the call and simulates a pairing step:
+// a zero PIN opens the PIN page, a negative PIN closes it and a positive
+// PIN creates new credentials.
+func (m *Remote) Pair(pin int) (string, int, string, error) {
+	if err := m.record("Pair", pin); err != nil {
+		return "", 0, "", err
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	switch {
+	case pin == 0:
+		m.pinPage = true
+		return "", 0, "", nil
+	case pin < 0:
+		m.pinPage = false
+		return "", 0, "", nil
+	}
+	m.pinPage = false
+	m.credentials.SessionID++
+	m.credentials.SessionKey = fmt.Sprintf("%032x", m.credentials.SessionID)
+	c := m.credentials
+	return c.DeviceUUID, c.SessionID, c.SessionKey, nil
+}
+
+// PairWith records the call and simulates a complete pairing, using the
+// PIN codes from the provider
+func (m *Remote) PairWith(p samtv.PINProvider) (samtv.Credentials, error) {
+	if err := m.record("PairWith"); err != nil {
+		return samtv.Credentials{}, err
+	}
+	if p == nil {
+		return samtv.Credentials{}, errors.New("no PIN provider")
+	}
+	if _, _, _, err := m.Pair(0); err != nil {
+		return samtv.Credentials{}, err
+	}
+	for attempt := 1; attempt <= samtv.PairingMaxAttempts; attempt++ {
+		pin, err := p.PIN(attempt)
+		if err != nil {
+			m.Pair(-1)
+			return samtv.Credentials{}, errors.Wrap(err, "could not get PIN code")
+		}
+		if _, _, _, err := m.Pair(pin); err == nil {
+			return m.Credentials(), nil
+		}
+	}
+	m.Pair(-1)
+	return samtv.Credentials{}, errors.New("too many failed attempts")
+}
+
+// PINPageState records the call and returns the mock PIN page state
+func (m *Remote) PINPageState() (string, error) {
+	if err := m.record("PINPageState"); err != nil {
+		return "", err
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.pinPage {
+		return "running", nil
+	}
+	return "stopped", nil
+}
+
+// Credentials returns the mock credentials
+// This call is not recorded.
+func (m *Remote) Credentials() samtv.Credentials {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.credentials
+}
+
+// SetCredentials records the call and sets the mock credentials
+func (m *Remote) SetCredentials(c samtv.Credentials) error {
+	if err := m.record("SetCredentials"); err != nil {
+		return err
+	}
+	m.mux.Lock()
+	m.credentials = c
+	m.mux.Unlock()
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtvmock_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/McKael/samtv"
+	"github.com/McKael/samtv/samtvmock"
+)
+
+func TestRemoteBackend(t *testing.T) {
+	m := samtvmock.New(samtv.Credentials{DeviceUUID: "test"})
+
+	// The mock can be used through the backend registry
+	samtv.RegisterBackend(samtvmock.Name, func(samtv.BackendOptions) (samtv.Backend, error) {
+		return m, nil
+	})
+	b, err := samtv.NewBackend(samtvmock.Name, samtv.BackendOptions{Address: "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errBusy := errors.New("busy")
+	m.QueueError("Key", nil, errBusy)
+
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Key("KEY_MUTE"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Key("KEY_CHUP"); err != errBusy {
+		t.Errorf("got error %v, want %v", err, errBusy)
+	}
+	if err := b.Key("KEY_CHUP"); err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+
+	m.AssertCalls(t, "Connect()", "Key(KEY_MUTE)", "Key(KEY_CHUP)", "Key(KEY_CHUP)", "Close()")
+	m.AssertKeys(t, "KEY_MUTE", "KEY_CHUP")
+	if m.Connected() {
+		t.Error("the mock connection is still open")
+	}
+}
+
+func TestRemotePairWith(t *testing.T) {
+	m := samtvmock.New(samtv.Credentials{DeviceUUID: "test"})
+
+	// The first PIN code is rejected
+	m.QueueError("Pair", nil, errors.New("bad PIN"))
+	pins := []int{1111, 1234}
+	c, err := m.PairWith(samtv.PINProviderFunc(func(attempt int) (int, error) {
+		return pins[attempt-1], nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.SessionKey == "" || c.SessionID == 0 || c.DeviceUUID != "test" {
+		t.Errorf("unexpected credentials %+v", c)
+	}
+	m.AssertCalls(t, "PairWith()", "Pair(0)", "Pair(1111)", "Pair(1234)")
+
+	if st, err := m.PINPageState(); err != nil || st != "stopped" {
+		t.Errorf("PIN page state = %q, %v; want stopped", st, err)
+	}
+}
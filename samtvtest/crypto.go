@@ -0,0 +1,168 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtvtest
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// The following values are the public pairing parameters used by the
+// smartcrypto package.
+
+var wbKey = []byte{
+	0xab, 0xbb, 0x12, 0x0c, 0x09, 0xe7, 0x11, 0x42,
+	0x43, 0xd1, 0xfa, 0x01, 0x02, 0x16, 0x3b, 0x27,
+}
+
+var privateKey = []byte{
+	0x2f, 0xd6, 0x33, 0x47, 0x13, 0x81, 0x6f, 0xae, 0x01, 0x8c, 0xde, 0xe4,
+	0x65, 0x6c, 0x50, 0x33, 0xa8, 0xd6, 0xb0, 0x0e, 0x8e, 0xae, 0xa0, 0x7b,
+	0x36, 0x24, 0x99, 0x92, 0x42, 0xe9, 0x62, 0x47, 0x11, 0x2d, 0xcd, 0x01,
+	0x9c, 0x41, 0x91, 0xf4, 0x64, 0x3c, 0x3c, 0xe1, 0x60, 0x50, 0x02, 0xb2,
+	0xe5, 0x06, 0xe7, 0xf1, 0xd1, 0xef, 0x8d, 0x9b, 0x80, 0x44, 0xe4, 0x6d,
+	0x37, 0xc0, 0xd5, 0x26, 0x32, 0x16, 0xa8, 0x7c, 0xd7, 0x83, 0xaa, 0x18,
+	0x54, 0x90, 0x43, 0x6c, 0x4a, 0x0c, 0xb2, 0xc5, 0x24, 0xe1, 0x5b, 0xc1,
+	0xbf, 0xea, 0xe7, 0x03, 0xbc, 0xbc, 0x4b, 0x74, 0xa0, 0x54, 0x02, 0x02,
+	0xe8, 0xd7, 0x9c, 0xad, 0xaa, 0xe8, 0x5c, 0x6f, 0x9c, 0x21, 0x8b, 0xc1,
+	0x10, 0x7d, 0x1f, 0x5b, 0x4b, 0x9b, 0xd8, 0x71, 0x60, 0xe7, 0x82, 0xf4,
+	0xe4, 0x36, 0xee, 0xb1, 0x74, 0x85, 0xab, 0x4d,
+}
+
+var prime = []byte{
+	0xb3, 0x61, 0xeb, 0x0a, 0xb0, 0x1c, 0x34, 0x39, 0xf2, 0xc1, 0x6f, 0xfd,
+	0xa7, 0xb0, 0x5e, 0x3e, 0x32, 0x07, 0x01, 0xeb, 0xee, 0x3e, 0x24, 0x91,
+	0x23, 0xc3, 0x58, 0x67, 0x65, 0xfd, 0x5b, 0xf6, 0xc1, 0xdf, 0xa8, 0x8b,
+	0xb6, 0xbb, 0x5d, 0xa3, 0xfd, 0xe7, 0x47, 0x37, 0xcd, 0x88, 0xb6, 0xa2,
+	0x6c, 0x5c, 0xa3, 0x1d, 0x81, 0xd1, 0x8e, 0x35, 0x15, 0x53, 0x3d, 0x08,
+	0xdf, 0x61, 0x93, 0x17, 0x06, 0x32, 0x24, 0xcf, 0x09, 0x43, 0xa2, 0xf2,
+	0x9a, 0x5f, 0xe6, 0x0c, 0x1c, 0x31, 0xdd, 0xf2, 0x83, 0x34, 0xed, 0x76,
+	0xa6, 0x47, 0x8a, 0x11, 0x22, 0xfb, 0x24, 0xc4, 0xa9, 0x4c, 0x87, 0x11,
+	0x61, 0x7d, 0xdf, 0xe9, 0x0c, 0xf0, 0x2e, 0x64, 0x3c, 0xd8, 0x2d, 0x47,
+	0x48, 0xd6, 0xd4, 0xa7, 0xca, 0x2f, 0x47, 0xd8, 0x85, 0x63, 0xaa, 0x2b,
+	0xaf, 0x64, 0x82, 0xe1, 0x24, 0xac, 0xd7, 0xdd,
+}
+
+// generateClientHello builds the TV ClientHello message
+// The key is the AES key derived from the PIN code.
+func generateClientHello(userID string, key []byte) ([]byte, error) {
+	const gxSize = 0x80
+
+	// Random gx value, lower than the prime
+	gx := make([]byte, gxSize)
+	if _, err := rand.Read(gx); err != nil {
+		return nil, err
+	}
+	gx[0] &= 0x7f
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid PIN key")
+	}
+	encGx := make([]byte, gxSize)
+	cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(encGx, gx)
+
+	wbBlock, err := aes.NewCipher(wbKey)
+	if err != nil {
+		return nil, err
+	}
+	encWBGx := make([]byte, gxSize)
+	for i := 0; i < gxSize; i += aes.BlockSize {
+		wbBlock.Encrypt(encWBGx[i:], encGx[i:i+aes.BlockSize])
+	}
+
+	secret := new(big.Int).Exp(new(big.Int).SetBytes(gx),
+		new(big.Int).SetBytes(privateKey), new(big.Int).SetBytes(prime))
+	hash := sha1.Sum(append([]byte(userID), secret.Bytes()...))
+
+	var buf bytes.Buffer
+	buf.Write([]byte{0x01, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00})
+	binary.Write(&buf, binary.BigEndian, uint32(len(userID)+152))
+	binary.Write(&buf, binary.BigEndian, uint32(len(userID)))
+	buf.WriteString(userID)
+	buf.Write(encWBGx)
+	buf.Write(hash[:])
+	buf.Write([]byte{0x00, 0x00, 0x00, 0x00, 0x00})
+	return buf.Bytes(), nil
+}
+
+// generateClientAcknowledge builds the TV ClientAckMsg string
+func generateClientAcknowledge(skprime []byte) string {
+	h := sha1.Sum(append(append([]byte(nil), skprime...), 0x02))
+	return "0104000000000000000014" + fmt.Sprintf("%X", h) + "0000000000"
+}
+
+// aesEncrypt encrypts data with the session key (AES-ECB, PKCS#7 padding)
+// If badPadding is true, the padding is invalid.
+func aesEncrypt(key, data []byte, badPadding bool) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	bs := block.BlockSize()
+	padding := bs - len(data)%bs
+	data = append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	if badPadding {
+		data[len(data)-1] = byte(bs + 1)
+	}
+
+	out := make([]byte, len(data))
+	for i := 0; i < len(data); i += bs {
+		block.Encrypt(out[i:], data[i:i+bs])
+	}
+	return out, nil
+}
+
+// aesDecrypt decrypts data with the session key (AES-ECB, PKCS#7 padding)
+func aesDecrypt(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	bs := block.BlockSize()
+	if len(data) == 0 || len(data)%bs != 0 {
+		return nil, errors.New("encrypted text does not have full blocks")
+	}
+
+	out := make([]byte, len(data))
+	for i := 0; i < len(data); i += bs {
+		block.Decrypt(out[i:], data[i:i+bs])
+	}
+
+	padding := int(out[len(out)-1])
+	if padding == 0 || padding > bs {
+		return nil, errors.New("invalid padding")
+	}
+	for _, c := range out[len(out)-padding:] {
+		if int(c) != padding {
+			return nil, errors.New("invalid padding")
+		}
+	}
+	return out[:len(out)-padding], nil
+}
@@ -0,0 +1,254 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtvtest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/McKael/samtv"
+)
+
+const multiScreenChannelsPath = "/api/v2/channels/"
+
+// multiScreenHostID is the client identifier of the TV application
+const multiScreenHostID = "host"
+
+// multiScreenConn is a client connection to a MultiScreen channel
+type multiScreenConn struct {
+	c      *websocket.Conn
+	mux    sync.Mutex
+	client samtv.MultiScreenClient
+}
+
+func (mc *multiScreenConn) write(v interface{}) error {
+	mc.mux.Lock()
+	defer mc.mux.Unlock()
+	mc.c.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return mc.c.WriteJSON(v)
+}
+
+// multiScreenChannel is a MultiScreen channel of the fake TV application
+type multiScreenChannel struct {
+	clients    map[string]*multiScreenConn // Connected clients by ID
+	hostEvents []samtv.MultiScreenEvent    // Events received by the host
+}
+
+// multiScreenRequest is a request sent by a channel client
+type multiScreenRequest struct {
+	Method string `json:"method"`
+	Params struct {
+		Event string          `json:"event"`
+		To    string          `json:"to"`
+		Data  json.RawMessage `json:"data,omitempty"`
+	} `json:"params"`
+}
+
+// HostEvents returns the events received by the TV application on a
+// MultiScreen channel
+func (srv *Server) HostEvents(channelID string) []samtv.MultiScreenEvent {
+	srv.mux.Lock()
+	defer srv.mux.Unlock()
+	ch := srv.msChannels[channelID]
+	if ch == nil {
+		return nil
+	}
+	return append([]samtv.MultiScreenEvent(nil), ch.hostEvents...)
+}
+
+// SendHostEvent sends an event from the TV application to the clients of
+// a MultiScreen channel
+// The target is a client identifier, samtv.MultiScreenAll or
+// samtv.MultiScreenBroadcast.
+func (srv *Server) SendHostEvent(channelID, event string, data interface{}, to string) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "cannot encode event data")
+	}
+	srv.mux.Lock()
+	ch := srv.msChannels[channelID]
+	srv.mux.Unlock()
+	if ch == nil {
+		return errors.Errorf("no client connected to channel '%s'", channelID)
+	}
+	srv.routeMultiScreenEvent(channelID, samtv.MultiScreenEvent{
+		Event: event,
+		From:  multiScreenHostID,
+		Data:  raw,
+	}, to)
+	return nil
+}
+
+// serveMultiScreen handles a MultiScreen channel client connection
+func (srv *Server) serveMultiScreen(w http.ResponseWriter, r *http.Request) {
+	channelID := strings.TrimPrefix(r.URL.Path, multiScreenChannelsPath)
+	if channelID == "" || strings.Contains(channelID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	c, err := srv.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logrus.Debug("samtvtest: websocket upgrade failed: ", err)
+		return
+	}
+
+	attrs := make(map[string]interface{})
+	if name, err := base64.StdEncoding.DecodeString(r.URL.Query().Get("name")); err == nil {
+		attrs["name"] = string(name)
+	}
+
+	srv.mux.Lock()
+	srv.lastClientID++
+	mc := &multiScreenConn{
+		c: c,
+		client: samtv.MultiScreenClient{
+			ID:          fmt.Sprintf("client-%d", srv.lastClientID),
+			ConnectTime: time.Now().UnixNano() / int64(time.Millisecond),
+			Attributes:  attrs,
+		},
+	}
+	ch := srv.msChannels[channelID]
+	if ch == nil {
+		ch = &multiScreenChannel{clients: make(map[string]*multiScreenConn)}
+		srv.msChannels[channelID] = ch
+	}
+	clients := []samtv.MultiScreenClient{{ID: multiScreenHostID, IsHost: true}}
+	var others []*multiScreenConn
+	for _, o := range ch.clients {
+		clients = append(clients, o.client)
+		others = append(others, o)
+	}
+	clients = append(clients, mc.client)
+	ch.clients[mc.client.ID] = mc
+	srv.mux.Unlock()
+
+	defer func() {
+		srv.mux.Lock()
+		delete(ch.clients, mc.client.ID)
+		srv.mux.Unlock()
+		c.Close()
+		srv.routeMultiScreenEvent(channelID, clientEvent(samtv.MultiScreenClientDisconnect, mc.client), samtv.MultiScreenBroadcast)
+	}()
+
+	err = mc.write(map[string]interface{}{
+		"event": "ms.channel.connect",
+		"data": map[string]interface{}{
+			"id":      mc.client.ID,
+			"clients": clients,
+		},
+	})
+	if err != nil {
+		return
+	}
+	connect := clientEvent(samtv.MultiScreenClientConnect, mc.client)
+	for _, o := range others {
+		o.write(connect)
+	}
+
+	for {
+		var req multiScreenRequest
+		if err := c.ReadJSON(&req); err != nil {
+			if _, ok := err.(*json.SyntaxError); ok {
+				continue
+			}
+			return
+		}
+		if req.Method != "ms.channel.emit" || req.Params.Event == "" {
+			logrus.Debug("samtvtest: unhandled channel request: ", req.Method)
+			continue
+		}
+		to := req.Params.To
+		if to == "" {
+			to = multiScreenHostID
+		}
+		srv.routeMultiScreenEvent(channelID, samtv.MultiScreenEvent{
+			Event: req.Params.Event,
+			From:  mc.client.ID,
+			Data:  req.Params.Data,
+		}, to)
+	}
+}
+
+// clientEvent returns a client connection event
+func clientEvent(event string, client samtv.MultiScreenClient) samtv.MultiScreenEvent {
+	data, _ := json.Marshal(client)
+	return samtv.MultiScreenEvent{Event: event, Data: data}
+}
+
+// routeMultiScreenEvent delivers an event to its recipients
+// The host and the broadcast recipients do not include the sender.
+func (srv *Server) routeMultiScreenEvent(channelID string, ev samtv.MultiScreenEvent, to string) {
+	var targets []*multiScreenConn
+	srv.mux.Lock()
+	ch := srv.msChannels[channelID]
+	if ch == nil {
+		srv.mux.Unlock()
+		return
+	}
+	toHost := false
+	switch to {
+	case multiScreenHostID:
+		toHost = true
+	case samtv.MultiScreenAll, samtv.MultiScreenBroadcast:
+		toHost = true
+		for id, mc := range ch.clients {
+			if to == samtv.MultiScreenAll || id != ev.From {
+				targets = append(targets, mc)
+			}
+		}
+	default:
+		if mc := ch.clients[to]; mc != nil {
+			targets = append(targets, mc)
+		}
+	}
+	if toHost && ev.From != multiScreenHostID {
+		ch.hostEvents = append(ch.hostEvents, ev)
+	}
+	srv.mux.Unlock()
+
+	for _, mc := range targets {
+		mc.write(ev)
+	}
+}
+
+// closeMultiScreen closes the MultiScreen channel connections
+func (srv *Server) closeMultiScreen() {
+	srv.mux.Lock()
+	var conns []*multiScreenConn
+	for _, ch := range srv.msChannels {
+		for _, mc := range ch.clients {
+			conns = append(conns, mc)
+		}
+	}
+	srv.mux.Unlock()
+	for _, mc := range conns {
+		mc.c.Close()
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtvtest
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/McKael/smartcrypto"
+)
+
+// pendingPairing contains the state of a pairing in progress
+type pendingPairing struct {
+	skprime []byte
+	ctx     []byte
+}
+
+// authData contains the auth_data fields used by the pairing steps
+type authData struct {
+	AuthType     string `json:"auth_type"`
+	RequestID    string `json:"request_id,omitempty"`
+	SessionID    string `json:"session_id,omitempty"`
+	ServerHello  string `json:"GeneratorServerHello,omitempty"`
+	ClientHello  string `json:"GeneratorClientHello,omitempty"`
+	ServerAckMsg string `json:"ServerAckMsg,omitempty"`
+	ClientAckMsg string `json:"ClientAckMsg,omitempty"`
+}
+
+const pinPageXML = `<?xml version="1.0" encoding="UTF-8"?>
+<service xmlns="urn:dial-multiscreen-org:schemas:dial" xmlns:atom="http://www.w3.org/2005/Atom">
+  <name>CloudPINPage</name>
+  <options allowStop="true"/>
+  <state>%s</state>
+</service>
+`
+
+// pairingHandler returns the handler of the PIN page and pairing service
+func (srv *Server) pairingHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws/apps/CloudPINPage", srv.handlePINPage)
+	mux.HandleFunc("/ws/apps/CloudPINPage/run", srv.handlePINPage)
+	mux.HandleFunc("/ws/pairing", srv.handlePairingStep)
+	return mux
+}
+
+func (srv *Server) handlePINPage(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		st := "stopped"
+		if srv.PINPageRunning() {
+			st = "running"
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, pinPageXML, st)
+	case http.MethodPost:
+		srv.setPINPage(true)
+		runURL := srv.baseURL(srv.ports.Pairing) + "/ws/apps/CloudPINPage/run"
+		w.Header().Set("Location", runURL)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, runURL)
+	case http.MethodDelete:
+		srv.setPINPage(false)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// setPINPage opens or closes the PIN page
+func (srv *Server) setPINPage(running bool) {
+	srv.mux.Lock()
+	if srv.pinPage == running {
+		srv.mux.Unlock()
+		return
+	}
+	srv.pinPage = running
+	if running {
+		srv.pin = srv.fixedPIN
+		if srv.pin == "" {
+			srv.pin = randomPIN()
+		}
+	}
+	pin, handler := srv.pin, srv.pinPageHandler
+	srv.mux.Unlock()
+
+	if handler != nil {
+		handler(pin, running)
+	}
+}
+
+func (srv *Server) handlePairingStep(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	deviceID := q.Get("device_id")
+	if deviceID == "" || q.Get("app_id") == "" {
+		http.Error(w, "missing identifier", http.StatusBadRequest)
+		return
+	}
+
+	var res authData
+	var err error
+
+	switch step := q.Get("step"); step {
+	case "0":
+		res = authData{AuthType: "SPC", RequestID: "0"}
+	case "1", "2":
+		var req struct {
+			AuthData authData `json:"auth_data"`
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, "cannot parse request", http.StatusBadRequest)
+			return
+		}
+		if step == "1" {
+			res, err = srv.pairingStep1(deviceID, req.AuthData)
+		} else {
+			res, err = srv.pairingStep2(deviceID, req.AuthData)
+		}
+	default:
+		err = errors.New("unknown pairing step")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The auth_data item is a JSON-encoded string
+	ad, _ := json.Marshal(res)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		AuthData string `json:"auth_data"`
+	}{string(ad)})
+}
+
+// pairingStep1 checks the ServerHello and sends the ClientHello
+func (srv *Server) pairingStep1(deviceID string, req authData) (authData, error) {
+	srv.mux.Lock()
+	pin, running := srv.pin, srv.pinPage
+	srv.mux.Unlock()
+	if !running {
+		return authData{}, errors.New("PIN page is not running")
+	}
+
+	serverHello, err := hex.DecodeString(req.ServerHello)
+	if err != nil {
+		return authData{}, errors.New("invalid ServerHello")
+	}
+	userID, err := parseServerHelloUserID(serverHello)
+	if err != nil {
+		return authData{}, err
+	}
+
+	// Compute the expected ServerHello with our PIN code
+	hello := smartcrypto.HelloData{UserID: userID, PIN: pin}
+	expected, err := smartcrypto.GenerateServerHello(&hello)
+	if err != nil {
+		return authData{}, err
+	}
+
+	clientHello, err := generateClientHello(userID, hello.Key)
+	if err != nil {
+		return authData{}, err
+	}
+	ch := hex.EncodeToString(clientHello)
+
+	// If the PIN is wrong, the client will not be able to check our
+	// ClientHello and the pairing will fail.
+	srv.mux.Lock()
+	delete(srv.pairings, deviceID)
+	if string(expected) == string(serverHello) {
+		skprime, ctx, err := smartcrypto.ParseClientHello(hello, ch)
+		if err != nil {
+			srv.mux.Unlock()
+			return authData{}, err
+		}
+		srv.pairings[deviceID] = &pendingPairing{skprime: skprime, ctx: ctx}
+	}
+	srv.mux.Unlock()
+
+	return authData{
+		AuthType:    "SPC",
+		RequestID:   "0",
+		ClientHello: ch,
+	}, nil
+}
+
+// pairingStep2 checks the ServerAckMsg and creates the new session
+func (srv *Server) pairingStep2(deviceID string, req authData) (authData, error) {
+	srv.mux.Lock()
+	p := srv.pairings[deviceID]
+	delete(srv.pairings, deviceID)
+	srv.mux.Unlock()
+	if p == nil {
+		return authData{}, errors.New("no pairing in progress")
+	}
+
+	serverAck, err := smartcrypto.GenerateServerAcknowledge(append([]byte(nil), p.skprime...))
+	if err != nil {
+		return authData{}, err
+	}
+	if req.ServerAckMsg != serverAck {
+		return authData{}, errors.New("invalid ServerAckMsg")
+	}
+
+	id := srv.addSession(deviceID, p.ctx)
+	return authData{
+		AuthType:     "SPC",
+		RequestID:    req.RequestID,
+		SessionID:    strconv.Itoa(id),
+		ClientAckMsg: generateClientAcknowledge(p.skprime),
+	}, nil
+}
+
+// parseServerHelloUserID returns the user ID from the ServerHello data
+func parseServerHelloUserID(data []byte) (string, error) {
+	// Header (7 bytes), data length, user ID length, user ID...
+	if len(data) < 15 {
+		return "", errors.New("ServerHello is too short")
+	}
+	l := int(binary.BigEndian.Uint32(data[11:15]))
+	if l < 1 || 15+l > len(data) {
+		return "", errors.New("invalid ServerHello user ID length")
+	}
+	return string(data[15 : 15+l]), nil
+}
@@ -0,0 +1,315 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package samtvtest provides a fake Samsung Smart TV for integration tests.
+//
+// The fake TV behaves like a 2014/2015 model (H/J series): it serves the
+// device description, the PIN page and pairing endpoints, the encrypted
+// SmartView remote control service and the MultiScreen channels, on local
+// ports.
+// Failures can be injected with SetFaults.
+package samtvtest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+
+	"github.com/McKael/samtv"
+)
+
+// Config contains the fake TV settings
+type Config struct {
+	Address     string                        // Listening IP address (default 127.0.0.1)
+	Ports       samtv.Ports                   // Service ports (0 for a random port)
+	PIN         string                        // Pairing PIN code (random if empty)
+	Description *samtv.SmartDeviceDescription // Device description
+}
+
+// Faults contains the failures injected by the fake TV
+type Faults struct {
+	Latency      time.Duration // Delay before each SmartView reply
+	DropReplies  bool          // Do not reply to SmartView requests
+	BadPadding   bool          // Send replies with an invalid padding
+	Disconnect   bool          // Close the connection when a request is received
+	Unauthorized bool          // Reply to the requests with a 401 error
+}
+
+// Server is a fake Samsung Smart TV
+type Server struct {
+	address     string
+	ports       samtv.Ports
+	description samtv.SmartDeviceDescription
+	servers     []*http.Server
+	upgrader    websocket.Upgrader
+
+	mux            sync.Mutex
+	faults         Faults
+	fixedPIN       string
+	pin            string
+	pinPage        bool
+	pairings       map[string]*pendingPairing // Pending pairings by device ID
+	sessions       map[int]*pairedSession     // Paired sessions by ID
+	lastSessionID  int
+	conns          map[*smartViewConn]bool
+	msChannels     map[string]*multiScreenChannel // MultiScreen channels by ID
+	lastClientID   int
+	keys           []string
+	keyHandler     func(key string)
+	pinPageHandler func(pin string, running bool)
+}
+
+// pairedSession contains the data of a paired device
+type pairedSession struct {
+	deviceID string
+	key      []byte
+}
+
+// NewServer starts a new fake TV
+func NewServer(cfg Config) (*Server, error) {
+	srv := &Server{
+		address:    cfg.Address,
+		fixedPIN:   cfg.PIN,
+		pairings:   make(map[string]*pendingPairing),
+		sessions:   make(map[int]*pairedSession),
+		conns:      make(map[*smartViewConn]bool),
+		msChannels: make(map[string]*multiScreenChannel),
+	}
+	if srv.address == "" {
+		srv.address = "127.0.0.1"
+	}
+
+	// Open the service listeners
+	var listeners []net.Listener
+	for _, port := range []int{cfg.Ports.SocketIO, cfg.Ports.Description, cfg.Ports.Pairing} {
+		l, err := net.Listen("tcp", net.JoinHostPort(srv.address, strconv.Itoa(port)))
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, errors.Wrap(err, "cannot listen")
+		}
+		listeners = append(listeners, l)
+	}
+	srv.ports = samtv.Ports{
+		SocketIO:    listeners[0].Addr().(*net.TCPAddr).Port,
+		Description: listeners[1].Addr().(*net.TCPAddr).Port,
+		Pairing:     listeners[2].Addr().(*net.TCPAddr).Port,
+	}
+
+	if cfg.Description != nil {
+		srv.description = *cfg.Description
+	} else {
+		srv.description = srv.defaultDescription()
+	}
+
+	handlers := []http.Handler{
+		srv.smartViewHandler(),
+		srv.descriptionHandler(),
+		srv.pairingHandler(),
+	}
+	for i, l := range listeners {
+		hs := &http.Server{Handler: handlers[i]}
+		srv.servers = append(srv.servers, hs)
+		go hs.Serve(l)
+	}
+
+	return srv, nil
+}
+
+// Close stops the fake TV
+func (srv *Server) Close() error {
+	srv.Disconnect()
+	srv.closeMultiScreen()
+	var err error
+	for _, hs := range srv.servers {
+		if e := hs.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Address returns the IP address of the fake TV
+func (srv *Server) Address() string {
+	return srv.address
+}
+
+// Ports returns the service ports of the fake TV
+func (srv *Server) Ports() samtv.Ports {
+	return srv.ports
+}
+
+// NewSession returns a new SmartViewSession for the fake TV
+func (srv *Server) NewSession() (*samtv.SmartViewSession, error) {
+	s, err := samtv.NewSmartViewSession(srv.address)
+	if err != nil {
+		return nil, err
+	}
+	s.SetPorts(srv.ports)
+	return s, nil
+}
+
+// SetFaults sets the failures injected by the fake TV
+func (srv *Server) SetFaults(f Faults) {
+	srv.mux.Lock()
+	srv.faults = f
+	srv.mux.Unlock()
+}
+
+// SetKeyHandler sets a function called for each key received by the TV
+func (srv *Server) SetKeyHandler(f func(key string)) {
+	srv.mux.Lock()
+	srv.keyHandler = f
+	srv.mux.Unlock()
+}
+
+// SetPINPageHandler sets a function called when the PIN page is opened
+// or closed
+func (srv *Server) SetPINPageHandler(f func(pin string, running bool)) {
+	srv.mux.Lock()
+	srv.pinPageHandler = f
+	srv.mux.Unlock()
+}
+
+// PIN returns the PIN code displayed by the TV
+// The PIN code is empty when the PIN page is not running.
+func (srv *Server) PIN() string {
+	srv.mux.Lock()
+	defer srv.mux.Unlock()
+	if !srv.pinPage {
+		return ""
+	}
+	return srv.pin
+}
+
+// PINPageRunning returns true if the PIN page is displayed
+func (srv *Server) PINPageRunning() bool {
+	srv.mux.Lock()
+	defer srv.mux.Unlock()
+	return srv.pinPage
+}
+
+// Keys returns the keys received by the TV
+func (srv *Server) Keys() []string {
+	srv.mux.Lock()
+	defer srv.mux.Unlock()
+	return append([]string(nil), srv.keys...)
+}
+
+// AddSession registers a new paired session without the pairing process
+// and returns its credentials.
+func (srv *Server) AddSession(deviceID string) (samtv.Credentials, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return samtv.Credentials{}, err
+	}
+	id := srv.addSession(deviceID, key)
+	return samtv.Credentials{
+		DeviceUUID: deviceID,
+		SessionID:  id,
+		SessionKey: hex.EncodeToString(key),
+	}, nil
+}
+
+func (srv *Server) addSession(deviceID string, key []byte) int {
+	srv.mux.Lock()
+	defer srv.mux.Unlock()
+	srv.lastSessionID++
+	srv.sessions[srv.lastSessionID] = &pairedSession{
+		deviceID: deviceID,
+		key:      key,
+	}
+	return srv.lastSessionID
+}
+
+// ResetSessions forgets all the paired sessions, like a factory reset
+func (srv *Server) ResetSessions() {
+	srv.mux.Lock()
+	srv.sessions = make(map[int]*pairedSession)
+	srv.pairings = make(map[string]*pendingPairing)
+	srv.mux.Unlock()
+}
+
+// Disconnect closes all the SmartView connections
+func (srv *Server) Disconnect() {
+	srv.mux.Lock()
+	conns := srv.conns
+	srv.conns = make(map[*smartViewConn]bool)
+	srv.mux.Unlock()
+	for c := range conns {
+		c.close()
+	}
+}
+
+// baseURL returns the base URL of a service
+func (srv *Server) baseURL(port int) string {
+	return "http://" + net.JoinHostPort(srv.address, strconv.Itoa(port))
+}
+
+func (srv *Server) defaultDescription() samtv.SmartDeviceDescription {
+	return samtv.SmartDeviceDescription{
+		DUID:              "uuid:0ee9e4b6-2a5c-4f6b-9cf1-5b5e0f3bd001",
+		Model:             "14_X14_BT",
+		ModelName:         "UE40H6400",
+		ModelDescription:  "Samsung DTV RCR",
+		NetworkType:       "wired",
+		IP:                srv.address,
+		FirmwareVersion:   "Unknown",
+		DeviceName:        "[TV] Fake Samsung TV",
+		DeviceID:          "FAKETV0001",
+		UDN:               "uuid:0ee9e4b6-2a5c-4f6b-9cf1-5b5e0f3bd001",
+		Resolution:        "1920x1080",
+		CountryCode:       "FR",
+		SmartHubAgreement: "true",
+		ServiceURI:        srv.baseURL(srv.ports.Description) + "/ms/1.0/",
+		DialURI:           srv.baseURL(srv.ports.Pairing) + "/ws/apps/",
+	}
+}
+
+// descriptionHandler returns the handler of the device description service
+func (srv *Server) descriptionHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ms/1.0/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(srv.description)
+	})
+	mux.HandleFunc(multiScreenChannelsPath, srv.serveMultiScreen)
+	return mux
+}
+
+// randomPIN returns a random 4-digit PIN code
+func randomPIN() string {
+	n, err := rand.Int(rand.Reader, big.NewInt(9000))
+	if err != nil {
+		return "1234"
+	}
+	return fmt.Sprintf("%d", 1000+n.Int64())
+}
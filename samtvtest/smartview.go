@@ -0,0 +1,265 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtvtest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	smartMessageInit       = "1::"
+	smartMessageHello      = "1::/com.samsung.companion"
+	smartMessageKeepalive  = "2::"
+	smartMessageCommPrefix = "5::/com.samsung.companion:"
+	smartMessageError      = "7::/com.samsung.companion:"
+)
+
+// heartbeatInterval is the delay between two socket.io keepalive messages
+const heartbeatInterval = 25 * time.Second
+
+// smartViewConn is a SmartView websocket connection
+type smartViewConn struct {
+	c    *websocket.Conn
+	mux  sync.Mutex
+	done chan struct{}
+	once sync.Once
+}
+
+func (sc *smartViewConn) write(msg string) error {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	sc.c.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return sc.c.WriteMessage(websocket.TextMessage, []byte(msg))
+}
+
+func (sc *smartViewConn) close() {
+	sc.once.Do(func() {
+		close(sc.done)
+		sc.c.Close()
+	})
+}
+
+// smartViewRequest is a callCommon request
+type smartViewRequest struct {
+	Name string `json:"name"`
+	Args []struct {
+		SessionID int    `json:"Session_Id"`
+		Body      string `json:"body"`
+	} `json:"args"`
+}
+
+// remoteControlRequest is the decrypted body of a callCommon request
+type remoteControlRequest struct {
+	Method string `json:"method"`
+	Body   struct {
+		Plugin  string `json:"plugin"`
+		Param1  string `json:"param1"`
+		Param2  string `json:"param2"`
+		Param3  string `json:"param3"`
+		API     string `json:"api"`
+		Version string `json:"version"`
+	} `json:"body"`
+}
+
+// smartViewHandler returns the handler of the socket.io service
+func (srv *Server) smartViewHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/socket.io/1/", func(w http.ResponseWriter, r *http.Request) {
+		// socket.io handshake: session ID, heartbeat and close timeouts,
+		// supported transports
+		id := make([]byte, 8)
+		rand.Read(id)
+		fmt.Fprintf(w, "%s:%d:%d:websocket", hex.EncodeToString(id),
+			int(heartbeatInterval/time.Second)*2, int(heartbeatInterval/time.Second)*2)
+	})
+	mux.HandleFunc("/socket.io/1/websocket/", srv.serveSmartView)
+	return mux
+}
+
+func (srv *Server) serveSmartView(w http.ResponseWriter, r *http.Request) {
+	c, err := srv.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logrus.Debug("samtvtest: websocket upgrade failed: ", err)
+		return
+	}
+	sc := &smartViewConn{c: c, done: make(chan struct{})}
+	srv.mux.Lock()
+	srv.conns[sc] = true
+	srv.mux.Unlock()
+
+	defer func() {
+		srv.mux.Lock()
+		delete(srv.conns, sc)
+		srv.mux.Unlock()
+		sc.close()
+	}()
+
+	// Keepalive messages
+	go func() {
+		t := time.NewTicker(heartbeatInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-sc.done:
+				return
+			case <-t.C:
+				sc.write(smartMessageKeepalive)
+			}
+		}
+	}()
+
+	if err := sc.write(smartMessageInit); err != nil {
+		return
+	}
+
+	for {
+		t, p, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		if t != websocket.TextMessage {
+			continue
+		}
+		msg := string(p)
+		switch {
+		case msg == smartMessageHello:
+			sc.write(smartMessageHello)
+		case msg == smartMessageKeepalive:
+		case strings.HasPrefix(msg, smartMessageCommPrefix):
+			if !srv.handleSmartViewRequest(sc, msg[len(smartMessageCommPrefix):]) {
+				return
+			}
+		default:
+			logrus.Debug("samtvtest: unhandled message: ", msg)
+		}
+	}
+}
+
+// handleSmartViewRequest processes a callCommon request
+// It returns false if the connection should be closed.
+func (srv *Server) handleSmartViewRequest(sc *smartViewConn, msg string) bool {
+	srv.mux.Lock()
+	faults := srv.faults
+	srv.mux.Unlock()
+
+	if faults.Disconnect {
+		return false
+	}
+
+	var req smartViewRequest
+	if err := json.Unmarshal([]byte(msg), &req); err != nil || req.Name != "callCommon" || len(req.Args) != 1 {
+		logrus.Debug("samtvtest: invalid request: ", msg)
+		return true
+	}
+
+	srv.mux.Lock()
+	session := srv.sessions[req.Args[0].SessionID]
+	srv.mux.Unlock()
+	if session == nil {
+		sc.write(smartMessageError + "unknown session")
+		return true
+	}
+
+	var cipherdata []byte
+	if err := json.Unmarshal([]byte(req.Args[0].Body), &cipherdata); err != nil {
+		sc.write(smartMessageError + "invalid request body")
+		return true
+	}
+	plain, err := aesDecrypt(session.key, cipherdata)
+	if err != nil {
+		sc.write(smartMessageError + "cannot decrypt request")
+		return true
+	}
+	var rc remoteControlRequest
+	if err := json.Unmarshal(plain, &rc); err != nil {
+		sc.write(smartMessageError + "invalid request")
+		return true
+	}
+
+	reply := map[string]interface{}{
+		"plugin": rc.Body.Plugin,
+		"api":    rc.Body.API,
+	}
+	if faults.Unauthorized {
+		reply["error"] = map[string]interface{}{
+			"code":    401,
+			"message": "unauthorized",
+		}
+	} else if rc.Body.API == "SendRemoteKey" {
+		if key := rc.Body.Param3; key != "" {
+			srv.receiveKey(key)
+		}
+		reply["result"] = struct{}{}
+	} else {
+		reply["error"] = map[string]interface{}{
+			"code":    404,
+			"message": "unknown API",
+		}
+	}
+
+	if faults.Latency > 0 {
+		time.Sleep(faults.Latency)
+	}
+	if faults.DropReplies {
+		return true
+	}
+
+	data, _ := json.Marshal(reply)
+	enc, err := aesEncrypt(session.key, data, faults.BadPadding)
+	if err != nil {
+		return false
+	}
+
+	// The encrypted data is sent as a string containing a list of bytes
+	list := make([]int, len(enc))
+	for i, b := range enc {
+		list[i] = int(b)
+	}
+	args, _ := json.Marshal(list)
+	resp, _ := json.Marshal(struct {
+		Name string `json:"name"`
+		Args string `json:"args"`
+	}{"receiveCommon", string(args)})
+
+	return sc.write(smartMessageCommPrefix+string(resp)) == nil
+}
+
+// receiveKey records a key and calls the key handler
+func (srv *Server) receiveKey(key string) {
+	srv.mux.Lock()
+	srv.keys = append(srv.keys, key)
+	handler := srv.keyHandler
+	srv.mux.Unlock()
+
+	if handler != nil {
+		handler(key)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtvtest
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Sources is the list of input sources of the virtual TV
+var Sources = []string{"TV", "HDMI1", "HDMI2", "HDMI3", "HDMI4", "AV", "Component"}
+
+// MaxVolume is the maximum volume level
+const MaxVolume = 100
+
+// State is a simple model of a TV state, updated by remote control keys
+type State struct {
+	Power   bool
+	Volume  int
+	Mute    bool
+	Channel string // Current channel ("5" or "5-1")
+	Source  string
+	Menu    bool   // True if the menu is open
+	Input   string // Channel number being typed
+
+	previousChannel string
+}
+
+// NewState returns the initial state of a virtual TV
+func NewState() State {
+	return State{
+		Power:   true,
+		Volume:  10,
+		Channel: "1",
+		Source:  Sources[0],
+	}
+}
+
+// Apply updates the state with a remote control key
+// It returns false if the key has no effect.
+func (st *State) Apply(key string) bool {
+	switch key {
+	case "KEY_POWER", "KEY_PANNEL_POWER":
+		st.Power = !st.Power
+		st.Menu, st.Input = false, ""
+		return true
+	case "KEY_POWERON":
+		st.Power = true
+		return true
+	case "KEY_POWEROFF":
+		st.Power = false
+		st.Menu, st.Input = false, ""
+		return true
+	}
+
+	if !st.Power {
+		return false
+	}
+
+	switch key {
+	case "KEY_VOLUP", "KEY_PANNEL_VOLUP":
+		st.setVolume(st.Volume + 1)
+	case "KEY_VOLDOWN", "KEY_PANNEL_VOLDOW":
+		st.setVolume(st.Volume - 1)
+	case "KEY_MUTE":
+		st.Mute = !st.Mute
+	case "KEY_CHUP", "KEY_PANNEL_CHUP":
+		st.stepChannel(1)
+	case "KEY_CHDOWN", "KEY_PANNEL_CHDOWN":
+		st.stepChannel(-1)
+	case "KEY_PRECH":
+		if st.previousChannel == "" {
+			return false
+		}
+		st.setChannel(st.previousChannel)
+	case "KEY_PLUS100":
+		// Used as a dash for minor channel numbers
+		if st.Input == "" || strings.Contains(st.Input, "-") {
+			return false
+		}
+		st.Input += "-"
+	case "KEY_ENTER":
+		if st.Input != "" {
+			st.setChannel(strings.TrimSuffix(st.Input, "-"))
+			st.Input = ""
+			return true
+		}
+		if !st.Menu {
+			return false
+		}
+	case "KEY_MENU", "KEY_PANNEL_MENU":
+		st.Menu = !st.Menu
+	case "KEY_RETURN", "KEY_EXIT":
+		if !st.Menu && st.Input == "" {
+			return false
+		}
+		st.Menu, st.Input = false, ""
+	case "KEY_SOURCE", "KEY_PANNEL_SOURCE":
+		st.Source = Sources[(st.sourceIndex()+1)%len(Sources)]
+	case "KEY_TV", "KEY_DTV":
+		st.Source = "TV"
+	case "KEY_HDMI", "KEY_HDMI1":
+		st.Source = "HDMI1"
+	case "KEY_HDMI2", "KEY_HDMI3", "KEY_HDMI4":
+		st.Source = strings.TrimPrefix(key, "KEY_")
+	case "KEY_AV1", "KEY_AV2", "KEY_AV3":
+		st.Source = "AV"
+	case "KEY_COMPONENT1", "KEY_COMPONENT2":
+		st.Source = "Component"
+	default:
+		if strings.HasPrefix(key, "KEY_") && len(key) == 5 && key[4] >= '0' && key[4] <= '9' {
+			st.Input += key[4:]
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+func (st *State) setVolume(v int) {
+	if v < 0 {
+		v = 0
+	} else if v > MaxVolume {
+		v = MaxVolume
+	}
+	st.Volume = v
+	st.Mute = false
+}
+
+func (st *State) setChannel(ch string) {
+	if ch == "" || ch == st.Channel {
+		return
+	}
+	st.previousChannel = st.Channel
+	st.Channel = ch
+	st.Source = "TV"
+}
+
+// stepChannel changes the major channel number
+func (st *State) stepChannel(delta int) {
+	major, _ := strconv.Atoi(strings.SplitN(st.Channel, "-", 2)[0])
+	major += delta
+	if major < 1 {
+		major = 1
+	}
+	st.setChannel(strconv.Itoa(major))
+}
+
+func (st *State) sourceIndex() int {
+	for i, s := range Sources {
+		if s == st.Source {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,131 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtvtest
+
+import "testing"
+
+// repeatKey returns a key sequence pressing the same key n times
+func repeatKey(key string, n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = key
+	}
+	return keys
+}
+
+func TestStateApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []string
+		check   func(st State) bool
+		ignored string // Key expected to have no effect
+	}{
+		{
+			name:  "volume",
+			keys:  []string{"KEY_MUTE", "KEY_VOLUP", "KEY_VOLUP"},
+			check: func(st State) bool { return st.Volume == 12 && !st.Mute },
+		},
+		{
+			name:  "volume clamp",
+			keys:  repeatKey("KEY_VOLDOWN", 12),
+			check: func(st State) bool { return st.Volume == 0 },
+		},
+		{
+			name:  "volume max",
+			keys:  repeatKey("KEY_VOLUP", MaxVolume+5),
+			check: func(st State) bool { return st.Volume == MaxVolume },
+		},
+		{
+			name:  "mute",
+			keys:  []string{"KEY_MUTE"},
+			check: func(st State) bool { return st.Mute },
+		},
+		{
+			name:  "channel number",
+			keys:  []string{"KEY_HDMI2", "KEY_1", "KEY_2", "KEY_ENTER"},
+			check: func(st State) bool { return st.Channel == "12" && st.Source == "TV" && st.Input == "" },
+		},
+		{
+			name:    "minor channel number",
+			keys:    []string{"KEY_5", "KEY_PLUS100", "KEY_1", "KEY_ENTER"},
+			check:   func(st State) bool { return st.Channel == "5-1" },
+			ignored: "KEY_PLUS100",
+		},
+		{
+			name:  "previous channel",
+			keys:  []string{"KEY_CHUP", "KEY_CHUP", "KEY_PRECH"},
+			check: func(st State) bool { return st.Channel == "2" },
+		},
+		{
+			name:    "channel down",
+			keys:    []string{"KEY_CHDOWN"},
+			check:   func(st State) bool { return st.Channel == "1" },
+			ignored: "KEY_PRECH",
+		},
+		{
+			name:    "power off",
+			keys:    []string{"KEY_MENU", "KEY_POWEROFF"},
+			check:   func(st State) bool { return !st.Power && !st.Menu && st.Volume == 10 },
+			ignored: "KEY_VOLUP",
+		},
+		{
+			name:  "power toggle",
+			keys:  []string{"KEY_POWER", "KEY_POWER", "KEY_VOLUP"},
+			check: func(st State) bool { return st.Power && st.Volume == 11 },
+		},
+		{
+			name:  "source cycling",
+			keys:  []string{"KEY_SOURCE", "KEY_SOURCE"},
+			check: func(st State) bool { return st.Source == Sources[2] },
+		},
+		{
+			name:  "source wrap",
+			keys:  []string{"KEY_COMPONENT1", "KEY_SOURCE"},
+			check: func(st State) bool { return st.Source == Sources[0] },
+		},
+		{
+			name:    "menu",
+			keys:    []string{"KEY_MENU", "KEY_RETURN"},
+			check:   func(st State) bool { return !st.Menu },
+			ignored: "KEY_EXIT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := NewState()
+			for _, k := range tt.keys {
+				if !st.Apply(k) {
+					t.Errorf("key %s ignored", k)
+				}
+			}
+			if !tt.check(st) {
+				t.Errorf("unexpected state %+v", st)
+			}
+			if tt.ignored != "" {
+				prev := st
+				if st.Apply(tt.ignored) || st != prev {
+					t.Errorf("key %s changed the state: %+v", tt.ignored, st)
+				}
+			}
+		})
+	}
+}
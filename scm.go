@@ -0,0 +1,227 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// scmLayout is the record layout of a channel map file of a .scm archive
+// Integers are little-endian, names are UTF-16BE and the last byte of a
+// record is a checksum (sum of the previous bytes).
+// Samsung does not document the format; the record sizes and offsets are
+// the ones of the Samsung loader of ChanSort (ChanSort.Loader.Samsung.ini),
+// which describes the map files of each series.
+type scmLayout struct {
+	size      int // Record size
+	number    int // uint16 channel number
+	serviceID int // uint16 service ID, or -1
+	name      int // Name offset
+	nameSize  int
+	favorite  int // Favorite flags
+}
+
+// scmLayouts contains the known layouts (C to H series) by map file kind
+var scmLayouts = map[string][]scmLayout{
+	"analog": {
+		{size: 40, number: 9, serviceID: -1, name: 20, nameSize: 10, favorite: 31},
+		{size: 64, number: 9, serviceID: -1, name: 20, nameSize: 10, favorite: 40},
+	},
+	"digital": {
+		{size: 248, number: 0, serviceID: 6, name: 64, nameSize: 100, favorite: 246},
+		{size: 292, number: 0, serviceID: 6, name: 64, nameSize: 100, favorite: 290},
+		{size: 320, number: 0, serviceID: 6, name: 64, nameSize: 200, favorite: 289},
+	},
+	"satellite": {
+		{size: 144, number: 0, serviceID: 6, name: 36, nameSize: 100, favorite: 142},
+		{size: 172, number: 0, serviceID: 6, name: 36, nameSize: 100, favorite: 170},
+	},
+}
+
+// SCMList is a channel list of a .scm archive
+// The name is the map file name, e.g. "map-CableD".
+type SCMList struct {
+	Name     string      `json:"name"`
+	Channels []TVChannel `json:"channels"`
+}
+
+// ReadSCMFile reads a channel list archive exported by the TV
+func ReadSCMFile(filename string) ([]SCMList, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return ParseSCM(f, fi.Size())
+}
+
+// ParseSCM decodes the channel lists of a .scm archive
+// The .scm files are ZIP archives with a map file per tuner and
+// source (map-AirD, map-CableA...); empty lists are skipped.
+func ParseSCM(r io.ReaderAt, size int64) ([]SCMList, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid .scm archive")
+	}
+
+	var lists []SCMList
+	for _, f := range z.File {
+		name := path.Base(f.Name)
+		kind, chType := scmMapKind(name)
+		if kind == "" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot read %s", name)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot read %s", name)
+		}
+		if len(data) == 0 {
+			continue
+		}
+		channels, err := parseSCMMap(data, scmLayouts[kind], chType)
+		if err != nil {
+			return nil, errors.Wrap(err, name)
+		}
+		if len(channels) > 0 {
+			lists = append(lists, SCMList{Name: name, Channels: channels})
+		}
+	}
+	if len(lists) == 0 {
+		return nil, errors.New("no channel list in the archive")
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i].Name < lists[j].Name })
+	return lists, nil
+}
+
+// scmMapKind returns the layout kind and the channel type of a map file
+func scmMapKind(name string) (kind, chType string) {
+	if !strings.HasPrefix(name, "map-") {
+		return "", ""
+	}
+	src := strings.TrimPrefix(name, "map-")
+	switch {
+	case strings.HasPrefix(src, "Air") && strings.HasSuffix(src, "A"):
+		return "analog", "ATV"
+	case strings.HasPrefix(src, "Cable") && strings.HasSuffix(src, "A"):
+		return "analog", "CATV"
+	case strings.HasPrefix(src, "Air") && strings.HasSuffix(src, "D"):
+		return "digital", "DTV"
+	case strings.HasPrefix(src, "Cable") && strings.HasSuffix(src, "D"):
+		return "digital", "CDTV"
+	case strings.HasSuffix(src, "D"): // map-SateD, map-AstraHDPlusD...
+		return "satellite", "SDTV"
+	}
+	return "", ""
+}
+
+// parseSCMMap decodes the records of a map file
+// The layout with the most valid checksums is used; the records with an
+// invalid checksum are skipped.
+func parseSCMMap(data []byte, layouts []scmLayout, chType string) ([]TVChannel, error) {
+	if scmEmptyMap(data) {
+		return nil, nil
+	}
+
+	var layout *scmLayout
+	best := 0
+	for i := range layouts {
+		l := &layouts[i]
+		if len(data)%l.size != 0 {
+			continue
+		}
+		valid := 0
+		for off := 0; off < len(data); off += l.size {
+			if scmChecksumOK(data[off : off+l.size]) {
+				valid++
+			}
+		}
+		if valid > best {
+			layout, best = l, valid
+		}
+	}
+	if layout == nil {
+		return nil, errors.Errorf("unknown record layout (%d bytes)", len(data))
+	}
+
+	var channels []TVChannel
+	for off := 0; off < len(data); off += layout.size {
+		r := data[off : off+layout.size]
+		if !scmChecksumOK(r) {
+			continue // Empty or corrupted record
+		}
+		ch := TVChannel{
+			Type:     chType,
+			Major:    int(binary.LittleEndian.Uint16(r[layout.number:])),
+			Name:     decodeChannelName(r[layout.name : layout.name+layout.nameSize]),
+			Favorite: r[layout.favorite] != 0,
+		}
+		if ch.Major == 0 {
+			continue
+		}
+		if layout.serviceID >= 0 {
+			ch.ProgNum = int(binary.LittleEndian.Uint16(r[layout.serviceID:]))
+		}
+		channels = append(channels, ch)
+	}
+	sort.SliceStable(channels, func(i, j int) bool { return channels[i].Major < channels[j].Major })
+	return channels, nil
+}
+
+// scmEmptyMap returns true if the map file only contains empty records
+func scmEmptyMap(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// scmChecksumOK checks the checksum of a non-empty record
+func scmChecksumOK(r []byte) bool {
+	var sum byte
+	empty := true
+	for _, b := range r[:len(r)-1] {
+		sum += b
+		if b != 0 {
+			empty = false
+		}
+	}
+	return !empty && sum == r[len(r)-1]
+}
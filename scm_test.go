@@ -0,0 +1,89 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestReadSCMFile(t *testing.T) {
+	// Synthetic archive with anonymised names: a digital cable list with
+	// favourites, an empty record and a corrupted record, an analog list,
+	// an empty satellite list and a non-map file.
+	lists, err := ReadSCMFile("testdata/channel_list.scm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []SCMList{
+		{Name: "map-AirA", Channels: []TVChannel{
+			{Type: "ATV", Major: 5, Name: "Five"},
+		}},
+		{Name: "map-CableD", Channels: []TVChannel{
+			{Type: "CDTV", Major: 1, ProgNum: 1001, Name: "News 24", Favorite: true},
+			{Type: "CDTV", Major: 2, ProgNum: 1002, Name: "Sport.Plus", Favorite: true},
+			{Type: "CDTV", Major: 3, ProgNum: 1003, Name: "Channel Three"},
+		}},
+	}
+	if !reflect.DeepEqual(lists, want) {
+		t.Errorf("got %+v, want %+v", lists, want)
+	}
+}
+
+func TestParseSCMMap(t *testing.T) {
+	record := func(size int, b ...byte) []byte {
+		r := make([]byte, size)
+		copy(r, b)
+		for _, c := range r[:size-1] {
+			r[size-1] += c
+		}
+		return r
+	}
+	valid := record(40, 0, 0, 0, 0, 0, 0, 0, 0, 0, 9)
+	corrupted := append([]byte{}, valid...)
+	corrupted[39]++
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    int // Number of channels
+		wantErr bool
+	}{
+		{"valid", valid, 1, false},
+		{"empty records", make([]byte, 80), 0, false},
+		{"skip corrupted", append(append([]byte{}, valid...), corrupted...), 1, false},
+		{"only corrupted", corrupted, 0, true},
+		{"unknown size", valid[:39], 0, true},
+		{"garbage", bytes.Repeat([]byte{0xff}, 40), 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSCMMap(tt.data, scmLayouts["analog"], "ATV")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if len(got) != tt.want {
+			t.Errorf("%s: got %d channels, want %d", tt.name, len(got), tt.want)
+		}
+	}
+}
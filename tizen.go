@@ -0,0 +1,424 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// TizenBackend is the name of the Tizen backend (2016+ models)
+const TizenBackend = "tizen"
+
+const (
+	tizenRemotePath = "/api/v2/channels/samsung.remote.control"
+
+	// The user has to allow the connection on the TV
+	tizenAuthTimeout = 30 * time.Second
+)
+
+// Tizen remote control key commands
+const (
+	TizenClick   = "Click"
+	TizenPress   = "Press"
+	TizenRelease = "Release"
+)
+
+// TizenSession is a remote control session with a Tizen TV (2016+ models)
+// The TV displays a prompt to allow the connection; the access token
+// received afterwards should be saved with the credentials.
+type TizenSession struct {
+	tvAddress string // TV network IP
+	ports     Ports  // TV service ports
+	name      string // Client name displayed by the TV
+	token     string // Access token
+
+	mux  sync.Mutex
+	c    *websocket.Conn
+	auth chan error // Authorization result
+
+	credentialsChanged CredentialsChangedFunc // Called for new tokens
+}
+
+// tizenMessage is a message exchanged on the remote control channel
+type tizenMessage struct {
+	Event  string          `json:"event,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params interface{}     `json:"params,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// NewTizenSession initializes a new TizenSession
+func NewTizenSession(tvAddress string) (*TizenSession, error) {
+	if err := checkTVAddress(tvAddress); err != nil {
+		return nil, err
+	}
+	return &TizenSession{
+		tvAddress: tvAddress,
+		ports:     DefaultPorts,
+		name:      defaultAppID,
+	}, nil
+}
+
+func newTizenBackend(opts BackendOptions) (Backend, error) {
+	s, err := NewTizenSession(opts.Address)
+	if err != nil {
+		return nil, err
+	}
+	s.SetPorts(opts.Ports)
+	if err := s.SetCredentials(opts.Credentials); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// TizenSession implements the Backend and KeyPresser interfaces
+var _ Backend = (*TizenSession)(nil)
+var _ KeyPresser = (*TizenSession)(nil)
+
+// Name returns the backend name
+func (s *TizenSession) Name() string {
+	return TizenBackend
+}
+
+// SetPorts sets the TV service ports.  Zero values are ignored.
+// The secure remote control service is used if it is available, otherwise
+// the unencrypted service on the description port is used.
+func (s *TizenSession) SetPorts(p Ports) {
+	s.ports = s.ports.Merge(p)
+}
+
+// SetCredentials sets the access token and the client name (AppID)
+// Empty values are ignored.
+func (s *TizenSession) SetCredentials(c Credentials) error {
+	if c.Token != "" {
+		s.token = c.Token
+	}
+	if c.AppID != "" {
+		s.name = c.AppID
+	}
+	return nil
+}
+
+// SetCredentialsChangedFunc sets a function to be called when the TV
+// sends a new access token, so that it can be saved
+func (s *TizenSession) SetCredentialsChangedFunc(f CredentialsChangedFunc) {
+	s.mux.Lock()
+	s.credentialsChanged = f
+	s.mux.Unlock()
+}
+
+// Credentials returns the access token and the client name
+func (s *TizenSession) Credentials() Credentials {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return Credentials{
+		AppID: s.name,
+		Token: s.token,
+	}
+}
+
+// Connect opens the connection to the TV
+// If the TV does not know the client, the user has to allow the connection
+// on the TV.
+func (s *TizenSession) Connect() error {
+	s.mux.Lock()
+	connected := s.c != nil
+	prevToken := s.token
+	s.mux.Unlock()
+	if connected {
+		return nil
+	}
+
+	c, err := s.dial()
+	if err != nil {
+		return err
+	}
+
+	auth := make(chan error, 1)
+	s.mux.Lock()
+	s.c, s.auth = c, auth
+	s.mux.Unlock()
+	go s.readMessages(c)
+
+	select {
+	case err = <-auth:
+	case <-time.After(tizenAuthTimeout):
+		err = ErrAccessTimeout
+	}
+	if err != nil {
+		s.Close()
+		return err
+	}
+
+	// The TV sends a new token when the connection has been allowed
+	s.mux.Lock()
+	changed := s.token != prevToken
+	f := s.credentialsChanged
+	s.mux.Unlock()
+	if changed && f != nil {
+		f(s.Credentials())
+	}
+	return nil
+}
+
+// dial opens the websocket connection to the remote control channel
+func (s *TizenSession) dial() (*websocket.Conn, error) {
+	s.mux.Lock()
+	q := url.Values{}
+	q.Set("name", base64.StdEncoding.EncodeToString([]byte(s.name)))
+	if s.token != "" {
+		q.Set("token", s.token)
+	}
+	s.mux.Unlock()
+	return dialMultiScreen(s.tvAddress, s.ports, tizenRemotePath, q)
+}
+
+// dialMultiScreen opens a websocket connection to a MultiScreen service
+// The secure service is tried first; older models only have the
+// unencrypted service on the description port.
+func dialMultiScreen(tvAddress string, ports Ports, path string, q url.Values) (*websocket.Conn, error) {
+	// The TV uses a self-signed certificate
+	d := websocket.Dialer{
+		TLSClientConfig:  &tls.Config{InsecureSkipVerify: true},
+		HandshakeTimeout: 10 * time.Second,
+	}
+	query := "?" + q.Encode()
+
+	u := "wss://" + net.JoinHostPort(tvAddress, strconv.Itoa(ports.SecureRemote)) + path + query
+	logrus.Debug("Connecting to ", u)
+	c, _, err := d.Dial(u, nil)
+	if err == nil {
+		return c, nil
+	}
+	logrus.Debug("Secure connection failed: ", err)
+
+	u = "ws://" + net.JoinHostPort(tvAddress, strconv.Itoa(ports.Description)) + path + query
+	logrus.Debug("Connecting to ", u)
+	c, _, err = d.Dial(u, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot connect to the TV")
+	}
+	return c, nil
+}
+
+// readMessages handles the messages received from the TV
+func (s *TizenSession) readMessages(c *websocket.Conn) {
+	for {
+		_, p, err := c.ReadMessage()
+		if err != nil {
+			logrus.Debug("Tizen socket read failed: ", err)
+			s.mux.Lock()
+			if s.c == c {
+				s.c = nil
+			}
+			s.mux.Unlock()
+			s.authResult(errors.Wrap(err, "connection closed"))
+			return
+		}
+		logrus.Debugf("Tizen message: `%s`", p)
+
+		var msg tizenMessage
+		if err := json.Unmarshal(p, &msg); err != nil {
+			logrus.Info("Could not parse Tizen message: ", err)
+			continue
+		}
+
+		switch msg.Event {
+		case "ms.channel.connect":
+			var data struct {
+				Token string `json:"token"`
+			}
+			json.Unmarshal(msg.Data, &data)
+			if data.Token != "" {
+				s.mux.Lock()
+				if s.token != data.Token {
+					logrus.Debug("Received new access token")
+				}
+				s.token = data.Token
+				s.mux.Unlock()
+			}
+			s.authResult(nil)
+		case "ms.channel.unauthorized":
+			s.authResult(ErrAccessDenied)
+		case "ms.channel.timeOut":
+			s.authResult(ErrAccessTimeout)
+		case "ms.error":
+			logrus.Info("TV error message: ", string(msg.Data))
+		default:
+			logrus.Debug("Unhandled Tizen event: ", msg.Event)
+		}
+	}
+}
+
+// authResult reports the authorization result to Connect
+func (s *TizenSession) authResult(err error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.auth == nil {
+		return
+	}
+	s.auth <- err
+	s.auth = nil
+}
+
+// Close terminates the connection
+func (s *TizenSession) Close() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.c == nil {
+		return
+	}
+	s.c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	s.c.Close()
+	s.c = nil
+}
+
+// Key sends a key click to the TV
+func (s *TizenSession) Key(key string) error {
+	return s.SendKey(TizenClick, key)
+}
+
+// Press sends a key press to the TV
+// The key should be released with Release.
+func (s *TizenSession) Press(key string) error {
+	return s.SendKey(TizenPress, key)
+}
+
+// Release sends a key release to the TV
+func (s *TizenSession) Release(key string) error {
+	return s.SendKey(TizenRelease, key)
+}
+
+// SendKey sends a key command (TizenClick, TizenPress or TizenRelease)
+func (s *TizenSession) SendKey(cmd, key string) error {
+	if key == "" {
+		logrus.Info("Empty key -- ignored")
+		return nil
+	}
+	if err := s.Connect(); err != nil {
+		return errors.Wrap(err, "failed to open websocket connection")
+	}
+
+	m, _ := json.Marshal(tizenMessage{
+		Method: "ms.remote.control",
+		Params: map[string]string{
+			"Cmd":          cmd,
+			"DataOfCmd":    key,
+			"Option":       "false",
+			"TypeOfRemote": "SendRemoteKey",
+		},
+	})
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.c == nil {
+		return errors.New("no active connection")
+	}
+	logrus.Debugf("Sending Tizen message: `%s`", m)
+	s.c.SetWriteDeadline(time.Now().Add(15 * time.Second))
+	return s.c.WriteMessage(websocket.TextMessage, m)
+}
+
+// PairWith connects to the TV and waits for the user to allow the
+// connection on the TV.  The PIN provider is not used.
+func (s *TizenSession) PairWith(p PINProvider) (Credentials, error) {
+	s.Close()
+	logrus.Info("Please allow the connection on the TV...")
+	if err := s.Connect(); err != nil {
+		return Credentials{}, err
+	}
+	c := s.Credentials()
+	if c.Token == "" {
+		logrus.Info("The TV did not provide an access token")
+	}
+	return c, nil
+}
+
+// DeviceDescription fetches the description from the TV device
+func (s *TizenSession) DeviceDescription() (SmartDeviceDescription, error) {
+	var sdd SmartDeviceDescription
+
+	d, err := fetchURL("http://" + s.serviceAddress(s.ports.Description) + "/api/v2/")
+	if err != nil {
+		return sdd, err
+	}
+
+	var desc struct {
+		Device struct {
+			DUID            string `json:"duid"`
+			Model           string `json:"model"`
+			ModelName       string `json:"modelName"`
+			Name            string `json:"name"`
+			NetworkType     string `json:"networkType"`
+			SSID            string `json:"ssid"`
+			IP              string `json:"ip"`
+			ID              string `json:"id"`
+			UDN             string `json:"udn"`
+			Resolution      string `json:"resolution"`
+			CountryCode     string `json:"countryCode"`
+			Description     string `json:"description"`
+			FirmwareVersion string `json:"firmwareVersion"`
+		} `json:"device"`
+		URI     string `json:"uri"`
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal([]byte(d), &desc); err != nil {
+		logrus.Debug(d)
+		return sdd, errors.Wrap(err, "cannot parse JSON description")
+	}
+
+	sdd = SmartDeviceDescription{
+		DUID:             desc.Device.DUID,
+		Model:            desc.Device.Model,
+		ModelName:        desc.Device.ModelName,
+		ModelDescription: desc.Device.Description,
+		NetworkType:      desc.Device.NetworkType,
+		SSID:             desc.Device.SSID,
+		IP:               desc.Device.IP,
+		FirmwareVersion:  desc.Device.FirmwareVersion,
+		DeviceName:       desc.Device.Name,
+		DeviceID:         desc.Device.ID,
+		UDN:              desc.Device.UDN,
+		Resolution:       desc.Device.Resolution,
+		CountryCode:      desc.Device.CountryCode,
+		ServiceURI:       desc.URI,
+	}
+	if sdd.FirmwareVersion == "" {
+		sdd.FirmwareVersion = desc.Version
+	}
+	return sdd, nil
+}
+
+// serviceAddress returns the host:port address of a TV service
+func (s *TizenSession) serviceAddress(port int) string {
+	return s.tvAddress + ":" + strconv.Itoa(port)
+}
@@ -0,0 +1,305 @@
+// Copyright © 2018 Mikael Berthe <mikael@lilotux.net>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package samtv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ssdpAddress = "239.255.255.250:1900"
+	ssdpTimeout = 2 * time.Second
+	soapTimeout = 10 * time.Second
+)
+
+// upnpService is a UPnP service of the TV
+type upnpService struct {
+	serviceType string
+	controlURL  string
+}
+
+// upnpDeviceDescription is the UPnP device description format
+type upnpDeviceDescription struct {
+	URLBase string     `xml:"URLBase"`
+	Device  upnpDevice `xml:"device"`
+}
+
+type upnpDevice struct {
+	DeviceType   string `xml:"deviceType"`
+	FriendlyName string `xml:"friendlyName"`
+	ModelName    string `xml:"modelName"`
+	Services     []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+// findService looks for a service in the device and its sub-devices
+func (d *upnpDevice) findService(serviceType string) string {
+	for _, s := range d.Services {
+		if s.ServiceType == serviceType {
+			return s.ControlURL
+		}
+	}
+	for i := range d.Devices {
+		if u := d.Devices[i].findService(serviceType); u != "" {
+			return u
+		}
+	}
+	return ""
+}
+
+// findUPnPService finds a UPnP service of the TV
+// The device description location is discovered with SSDP; if the TV does
+// not answer, the default locations are used.
+func findUPnPService(tvAddress, serviceType string, defaultLocations ...string) (*upnpService, error) {
+	locations := ssdpSearch(tvAddress, serviceType)
+	locations = append(locations, defaultLocations...)
+
+	var lastErr error
+	for _, loc := range locations {
+		svc, err := loadUPnPService(loc, serviceType)
+		if err == nil {
+			logrus.Debugf("Found %s at %s", serviceType, svc.controlURL)
+			return svc, nil
+		}
+		logrus.Debugf("No %s service at %s: %v", serviceType, loc, err)
+		lastErr = err
+	}
+	return nil, errors.Wrap(lastErr, "UPnP service not found")
+}
+
+// findMediaRendererService finds a service of the TV media renderer
+func findMediaRendererService(tvAddress string, ports Ports, serviceType string) (*upnpService, error) {
+	if tvAddress == "" {
+		return nil, errors.New("empty TV IP address")
+	}
+	ports = DefaultPorts.Merge(ports)
+	loc := "http://" + net.JoinHostPort(tvAddress, strconv.Itoa(ports.MediaRenderer)) + "/dmr"
+	return findUPnPService(tvAddress, serviceType, loc)
+}
+
+// loadUPnPService reads a device description and returns the service
+func loadUPnPService(location, serviceType string) (*upnpService, error) {
+	client := &http.Client{Timeout: soapTimeout}
+	resp, err := client.Get(location)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not send request")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected response: %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read device response")
+	}
+
+	var desc upnpDeviceDescription
+	if err := xml.Unmarshal(body, &desc); err != nil {
+		return nil, errors.Wrap(err, "could not parse device description")
+	}
+	controlURL := desc.Device.findService(serviceType)
+	if controlURL == "" {
+		return nil, errors.New("service not listed in the device description")
+	}
+
+	base := location
+	if desc.URLBase != "" {
+		base = desc.URLBase
+	}
+	return &upnpService{
+		serviceType: serviceType,
+		controlURL:  resolveURL(base, controlURL),
+	}, nil
+}
+
+// ssdpSearch sends a SSDP search request and returns the location
+// provided by the TV.  It returns as soon as the TV has answered.
+func ssdpSearch(tvAddress, st string) []string {
+	// The TV address can be a host name
+	tvIPs, err := net.LookupHost(tvAddress)
+	if err != nil {
+		logrus.Debug("SSDP: ", err)
+		return nil
+	}
+
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		logrus.Debug("SSDP: ", err)
+		return nil
+	}
+	defer conn.Close()
+
+	dst, err := net.ResolveUDPAddr("udp4", ssdpAddress)
+	if err != nil {
+		return nil
+	}
+	req := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddress + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 1\r\n" +
+		"ST: " + st + "\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(req), dst); err != nil {
+		logrus.Debug("SSDP: ", err)
+		return nil
+	}
+
+	conn.SetReadDeadline(time.Now().Add(ssdpTimeout))
+	buf := make([]byte, 2048)
+	for {
+		n, src, err := conn.ReadFrom(buf)
+		if err != nil {
+			return nil // Timeout
+		}
+		if host, _, _ := net.SplitHostPort(src.String()); !containsString(tvIPs, host) {
+			continue
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		if loc := resp.Header.Get("Location"); loc != "" {
+			logrus.Debug("SSDP location: ", loc)
+			return []string{loc}
+		}
+	}
+}
+
+// containsString returns true if the list contains the string
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// soapArg is an argument of a SOAP action
+type soapArg struct {
+	Name  string
+	Value string
+}
+
+// soapFault contains a UPnP error
+type soapFault struct {
+	Code        int    `xml:"Body>Fault>detail>UPnPError>errorCode"`
+	Description string `xml:"Body>Fault>detail>UPnPError>errorDescription"`
+}
+
+// call sends a SOAP action and returns the output arguments
+func (s *upnpService) call(action string, args ...soapArg) (map[string]string, error) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0" encoding="utf-8"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" ` +
+		`s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(&body, `<u:%s xmlns:u="%s">`, action, s.serviceType)
+	for _, a := range args {
+		fmt.Fprintf(&body, "<%s>", a.Name)
+		xml.EscapeText(&body, []byte(a.Value))
+		fmt.Fprintf(&body, "</%s>", a.Name)
+	}
+	fmt.Fprintf(&body, "</u:%s></s:Body></s:Envelope>", action)
+
+	req, err := http.NewRequest("POST", s.controlURL, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPACTION", strconv.Quote(s.serviceType+"#"+action))
+
+	logrus.Debugf("SOAP action %s", action)
+	client := &http.Client{Timeout: soapTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not send request")
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read device response")
+	}
+	logrus.Debugf("SOAP response: `%s`", data)
+
+	if resp.StatusCode != http.StatusOK {
+		var fault soapFault
+		if xml.Unmarshal(data, &fault) == nil && fault.Code != 0 {
+			return nil, errors.Errorf("%s failed: UPnP error %d (%s)", action, fault.Code, fault.Description)
+		}
+		return nil, errors.Errorf("%s failed: %s", action, resp.Status)
+	}
+	return parseSOAPResponse(data, action+"Response")
+}
+
+// parseSOAPResponse returns the arguments of the SOAP response element
+func parseSOAPResponse(data []byte, element string) (map[string]string, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	out := make(map[string]string)
+	inResponse := false
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if inResponse {
+				return nil, errors.Wrap(err, "could not parse SOAP response")
+			}
+			return nil, errors.New("no response element in SOAP response")
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if !inResponse {
+				inResponse = t.Name.Local == element
+				continue
+			}
+			var v string
+			if err := d.DecodeElement(&v, &t); err != nil {
+				return nil, errors.Wrap(err, "could not parse SOAP response")
+			}
+			out[t.Name.Local] = v
+		case xml.EndElement:
+			if inResponse && t.Name.Local == element {
+				return out, nil
+			}
+		}
+	}
+}
+
+// parseUPnPBool parses a UPnP boolean value
+func parseUPnPBool(v string) bool {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
@@ -32,18 +32,21 @@ import (
 )
 
 const (
-	smartMessageInit       = "1::"
-	smartMessageHello      = "1::/com.samsung.companion"
-	smartMessageKeepalive  = "2::"
-	smartMessageCommPrefix = "5::/com.samsung.companion:"
+	smartMessageDisconnect  = "0::"
+	smartMessageInit        = "1::"
+	smartMessageHello       = "1::/com.samsung.companion"
+	smartMessageKeepalive   = "2::"
+	smartMessageCommPrefix  = "5::/com.samsung.companion:"
+	smartMessageErrorPrefix = "7:"
 )
 
 func (s *SmartViewSession) openWSConnection() error {
-	const queryPrefix = ":8000/socket.io/1"
+	const queryPrefix = "/socket.io/1"
+	address := s.serviceAddress(s.ports.SocketIO)
 
 	// Open conection
 	t := time.Now().UnixNano() / 1000000
-	step4URL := "http://" + s.tvAddress + queryPrefix + "/?t=" + strconv.FormatInt(t, 10)
+	step4URL := "http://" + address + queryPrefix + "/?t=" + strconv.FormatInt(t, 10)
 	websocketResponse, err := fetchURL(step4URL)
 	if err != nil {
 		return errors.Wrap(err, "websocket request failed")
@@ -51,7 +54,7 @@ func (s *SmartViewSession) openWSConnection() error {
 
 	// Build websocket URL
 	wsp := strings.SplitN(websocketResponse, ":", 2)[0]
-	u, err := url.Parse("ws://" + s.tvAddress + queryPrefix + "/websocket/" + wsp)
+	u, err := url.Parse("ws://" + address + queryPrefix + "/websocket/" + wsp)
 	if err != nil {
 		return errors.Wrap(err, "cannot create Websocket URL")
 	}
@@ -67,6 +70,16 @@ func (s *SmartViewSession) openWSConnection() error {
 	s.ws.mux.Lock()
 	s.ws.c = c
 	s.ws.state = stateOpeningSocket
+	// Discard the errors of a previous connection, e.g. when the TV has
+	// closed an idle connection
+DRAIN:
+	for {
+		select {
+		case <-s.ws.errs:
+		default:
+			break DRAIN
+		}
+	}
 	s.ws.mux.Unlock()
 	go s.manageWS()
 	// FIXME stopper
@@ -94,6 +107,7 @@ LOOP:
 		s.ws.mux.Unlock()
 		if err != nil {
 			logrus.Info("socket read failed: ", err)
+			s.pushError(errors.Wrap(err, "connection closed"))
 			s.ws.mux.Lock()
 			s.ws.state = stateNotConnected
 			s.ws.c.Close()
@@ -132,10 +146,24 @@ LOOP:
 			logrus.Debug("SmartView message received")
 			if smsg, err := s.parseSmartMessage(msg); err != nil {
 				logrus.Error("Could not parse message: ", err)
+				s.pushError(err)
 			} else {
 				logrus.Debug("SmartView message: ", smsg)
 				s.ws.read <- smsg
 			}
+		case strings.HasPrefix(msg, smartMessageErrorPrefix):
+			logrus.Info("SmartView error message: ", msg)
+			s.pushError(errors.Errorf("TV error message (%s)", msg))
+		case strings.HasPrefix(msg, smartMessageDisconnect):
+			logrus.Info("SmartView disconnection message: ", msg)
+			s.ws.mux.Lock()
+			state := s.ws.state
+			s.ws.mux.Unlock()
+			if state != stateConnected {
+				s.pushError(errors.New("connection closed by the TV"))
+			} else {
+				s.pushError(errors.New("disconnected by the TV"))
+			}
 		default:
 			logrus.Info("SmartView unhandled message: ", msg)
 		}
@@ -143,6 +171,15 @@ LOOP:
 	logrus.Debug("Leaving manageWS loop")
 }
 
+// pushError reports an error to the reader of the websocket messages
+func (s *SmartViewSession) pushError(err error) {
+	select {
+	case s.ws.errs <- err:
+	default:
+		logrus.Debug("Dropping websocket error: ", err)
+	}
+}
+
 // sendWSMessage sends a raw WebSocket message
 func (s *SmartViewSession) sendWSMessage(m string) error {
 	s.ws.mux.Lock()